@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -26,6 +27,11 @@ type ClusterDetectorSpec struct {
 	Context string `json:"context,omitempty"`
 	Cluster string `json:"cluster,omitempty"`
 	User    string `json:"user,omitempty"`
+
+	// Set on the ClusterDetector of the primary cluster, i.e. the cluster that plumber runs in.
+	// Exactly one ClusterDetector is the primary.
+	//+optional
+	Primary bool `json:"primary,omitempty"`
 }
 
 // ClusterDetectorStatus defines the observed state of ClusterDetector
@@ -34,11 +40,113 @@ type ClusterDetectorStatus struct {
 	// Running is set; if not, Unknown is set.
 	ClusterStatus string `json:"clusterstatus,omitempty"`
 
+	// Result of the health check of the kube-apiserver:
+	// Healthy, Unreachable, TLSError, Unauthorized or Unhealthy.
+	//+optional
+	Health string `json:"health,omitempty"`
+
 	// An error message is output when communication with a remote Kubernetes cluster is not possible.
 	// Output only when the wide option of the Kubectl get command is given.
 	Reason string `json:"reason,omitempty"`
+
+	// Time of the last health check.
+	//+optional
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
+
+	// Time when clusterstatus last changed.
+	//+optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Latency of the last health check.
+	//+optional
+	ProbeLatency *metav1.Duration `json:"probeLatency,omitempty"`
+
+	// 95th percentile of the latencies in probeHistory.
+	//+optional
+	ProbeLatencyP95 *metav1.Duration `json:"probeLatencyP95,omitempty"`
+
+	// Number of health checks that failed in a row.
+	//+optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+
+	// Number of health checks that succeeded in a row.
+	//+optional
+	ConsecutiveSuccesses int32 `json:"consecutiveSuccesses,omitempty"`
+
+	// Results of the most recent health checks, oldest first.
+	//+optional
+	ProbeHistory []ProbeResult `json:"probeHistory,omitempty"`
+
+	// What the cluster is, collected on every successful health check.
+	//+optional
+	Inventory *ClusterInventory `json:"inventory,omitempty"`
+
+	// Generation of the ClusterDetector that was last checked.
+	//+optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Reachable: The kube-apiserver of the cluster responds to the health check
+	// Authenticated: The credentials in the kubeconfig are accepted by the cluster
+	// Authorized: The credentials are allowed to manage the resources replicated by plumber
+	//+optional
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Result of a single health check of a cluster.
+type ProbeResult struct {
+	Time    metav1.Time     `json:"time"`
+	Health  string          `json:"health"`
+	Latency metav1.Duration `json:"latency"`
 }
 
+// Inventory of a cluster.
+type ClusterInventory struct {
+	// Kubernetes version of the kube-apiserver, e.g. v1.27.2.
+	//+optional
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+
+	// Operating system and architecture of the kube-apiserver, e.g. linux/amd64.
+	//+optional
+	Platform string `json:"platform,omitempty"`
+
+	// Number of nodes in the cluster.
+	//+optional
+	Nodes int32 `json:"nodes,omitempty"`
+
+	// Total cpu and memory of the nodes.
+	//+optional
+	Capacity corev1.ResourceList `json:"capacity,omitempty"`
+
+	// Total cpu and memory of the nodes available for Pods.
+	//+optional
+	Allocatable corev1.ResourceList `json:"allocatable,omitempty"`
+
+	// Names of the IngressClasses.
+	//+optional
+	IngressClasses []string `json:"ingressClasses,omitempty"`
+
+	// Names of the StorageClasses.
+	//+optional
+	StorageClasses []string `json:"storageClasses,omitempty"`
+
+	// API groups of the installed CustomResourceDefinitions.
+	//+optional
+	CRDGroups []string `json:"crdGroups,omitempty"`
+
+	// Time when the inventory was collected.
+	//+optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// Condition types of a ClusterDetector.
+const (
+	ClusterDetectorConditionReachable     = "Reachable"
+	ClusterDetectorConditionAuthenticated = "Authenticated"
+	ClusterDetectorConditionAuthorized    = "Authorized"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:resource:shortName=cd
 //+kubebuilder:subresource:status
@@ -46,6 +154,11 @@ type ClusterDetectorStatus struct {
 //+kubebuilder:printcolumn:name="CLUSTER",type="string",JSONPath=".spec.cluster"
 //+kubebuilder:printcolumn:name="USER",type="string",JSONPath=".spec.user"
 //+kubebuilder:printcolumn:name="CLUSTERSTATUS",type="string",JSONPath=".status.clusterstatus"
+//+kubebuilder:printcolumn:name="HEALTH",type="string",JSONPath=".status.health"
+//+kubebuilder:printcolumn:name="VERSION",type="string",JSONPath=".status.inventory.kubernetesVersion"
+//+kubebuilder:printcolumn:name="NODES",type="integer",JSONPath=".status.inventory.nodes"
+//+kubebuilder:printcolumn:name="LATENCY",type="string",priority=1,JSONPath=".status.probeLatency"
+//+kubebuilder:printcolumn:name="FAILURES",type="integer",priority=1,JSONPath=".status.consecutiveFailures"
 //+kubebuilder:printcolumn:name="REASON",type="string",priority=1,JSONPath=".status.reason"
 //+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 
@@ -0,0 +1,107 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ReplicationRunSpec identifies the Replicator and the spec that were synced
+type ReplicationRunSpec struct {
+	// Name of the Replicator that was synced.
+	Replicator string `json:"replicator"`
+
+	// Generation of the Replicator that was synced.
+	Generation int64 `json:"generation"`
+
+	// Revision of the spec, if the sync succeeded on all clusters and the spec was recorded as a revision.
+	//+optional
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// ReplicationRunStatus records the outcome of the sync
+type ReplicationRunStatus struct {
+	StartTime      metav1.Time `json:"startTime"`
+	CompletionTime metav1.Time `json:"completionTime"`
+
+	// Sync state of the Replicator after the sync, same as .status.synced of the Replicator.
+	Synced string `json:"synced"`
+
+	// Outcome per cluster.
+	//+optional
+	Clusters []ReplicationRunCluster `json:"clusters,omitempty"`
+}
+
+type ReplicationRunCluster struct {
+	Cluster string `json:"cluster"`
+
+	// Same as .status.clusters[].state of the Replicator.
+	State string `json:"state"`
+
+	// Error message when the replication failed.
+	//+optional
+	Message string `json:"message,omitempty"`
+
+	// Resources that were applied to the cluster, or whose apply failed.
+	// Resources that were already up to date are not listed.
+	//+optional
+	Resources []ReplicationRunResource `json:"resources,omitempty"`
+}
+
+type ReplicationRunResource struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+
+	// applied or not applied
+	ApplyStatus string `json:"applyStatus"`
+
+	// Error message when the apply failed.
+	//+optional
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster,shortName=run
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="REPLICATOR",type="string",JSONPath=".spec.replicator"
+//+kubebuilder:printcolumn:name="REVISION",type="integer",JSONPath=".spec.revision"
+//+kubebuilder:printcolumn:name="SYNCED",type="string",JSONPath=".status.synced"
+//+kubebuilder:printcolumn:name="STARTED",type="date",JSONPath=".status.startTime"
+//+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ReplicationRun is the Schema for the replicationruns API.
+// A ReplicationRun is created for every sync of a Replicator that changed a resource on any cluster.
+type ReplicationRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ReplicationRunSpec   `json:"spec,omitempty"`
+	Status ReplicationRunStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ReplicationRunList contains a list of ReplicationRun
+type ReplicationRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ReplicationRun `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ReplicationRun{}, &ReplicationRunList{})
+}
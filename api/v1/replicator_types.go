@@ -27,6 +27,7 @@ import (
 	"encoding/json"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	appsv1apply "k8s.io/client-go/applyconfigurations/apps/v1"
 	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
 	networkv1apply "k8s.io/client-go/applyconfigurations/networking/v1"
@@ -104,6 +105,163 @@ type ReplicatorSpec struct {
 
 	//+optional
 	TargetCluster []string `json:"targetCluster"`
+
+	// APIs the workload needs besides the replicated resources, e.g. the CRDs of a service mesh.
+	// Secondary clusters that do not serve any of them are skipped,
+	// as are clusters without the nginx IngressClass or the StorageClasses of the ephemeral volumes.
+	//+optional
+	RequiredAPIs []RequiredAPI `json:"requiredAPIs,omitempty"`
+
+	// What happens to the replicated resources when the Replicator is deleted.
+	// Defaults to Delete.
+	//+optional
+	//+kubebuilder:default=Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// Overrides DeletionPolicy for individual clusters,
+	// e.g. to keep the workload running on a DR cluster.
+	//+optional
+	ClusterDeletionPolicies []ClusterDeletionPolicy `json:"clusterDeletionPolicies,omitempty"`
+
+	// How long the finalizer keeps retrying the cleanup of unreachable secondary clusters.
+	// When it expires, the cleanup of the remaining clusters is abandoned and the Replicator is deleted.
+	// If not set, the cleanup is retried until it succeeds or the force-delete annotation is set.
+	//+optional
+	CleanupTimeout *metav1.Duration `json:"cleanupTimeout,omitempty"`
+
+	// Stop applying the resources to all clusters.
+	// The clusters are still checked, and resources that differ from the Replicator are reported as drifted.
+	//+optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Preview the changes instead of applying them.
+	// Every apply is sent to the clusters with DryRun All, and the result per cluster and resource
+	// is reported in .status.dryRun. Nothing is mutated on any cluster.
+	//+optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// How the Replicator is synced to the clusters.
+	//+optional
+	SyncPolicy *SyncPolicy `json:"syncPolicy,omitempty"`
+
+	// Number of previously synced specs kept as ControllerRevisions for rollback.
+	// Defaults to 10.
+	//+optional
+	//+kubebuilder:validation:Minimum=1
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// Re-apply a previous revision to all clusters.
+	// The spec of the revision replaces the current spec and the field is cleared.
+	//+optional
+	RollbackTo *RollbackConfig `json:"rollbackTo,omitempty"`
+
+	// Roll changes out to the secondary clusters in waves instead of to all of them at once.
+	// If not set, all secondary clusters are replicated to at the same time.
+	//+optional
+	Rollout *RolloutStrategy `json:"rollout,omitempty"`
+}
+
+// An API that a cluster must serve for the Replicator to be replicated to it.
+type RequiredAPI struct {
+	// e.g. monitoring.coreos.com/v1. v1 is the core API group.
+	GroupVersion string `json:"groupVersion"`
+
+	// e.g. servicemonitors. If empty, any resource of the group version is enough.
+	//+optional
+	Resource string `json:"resource,omitempty"`
+}
+
+type SyncPolicy struct {
+	// Apply to the clusters only after a dry run has succeeded on all of them.
+	// If an apply still fails part-way, the clusters that were updated are rolled back to the last stable spec.
+	//+optional
+	Atomic bool `json:"atomic,omitempty"`
+
+	// Number or percentage of clusters, including the primary cluster, that must be applied
+	// for the Replicator to be reported as Degraded instead of Failed when some clusters are not applied.
+	// A percentage is rounded up.
+	// If not set, all clusters must be applied.
+	//+optional
+	MinSuccessfulClusters *intstr.IntOrString `json:"minSuccessfulClusters,omitempty"`
+}
+
+type RollbackConfig struct {
+	// Revision to roll back to. If zero, the revision before the current one is used.
+	//+optional
+	//+kubebuilder:validation:Minimum=0
+	Revision int64 `json:"revision,omitempty"`
+}
+
+type RolloutStrategy struct {
+	// Secondary clusters that get the change before all waves.
+	// The change is promoted to the waves only after the canary clusters stayed healthy for the bake time.
+	//+optional
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+
+	// Waves are rolled out in order. A wave starts only after the Deployments of all clusters
+	// in the previous wave are Available with the new generation.
+	// Secondary clusters that do not belong to any wave form an implicit final wave.
+	//+optional
+	Waves []RolloutWave `json:"waves,omitempty"`
+
+	// Stop the rollout at the current wave if the replication to one of its clusters fails.
+	// Otherwise the failed clusters are left behind and the rollout continues with the next wave.
+	// A paused rollout is restarted by changing the spec of the Replicator.
+	//+optional
+	PauseOnFailure bool `json:"pauseOnFailure,omitempty"`
+}
+
+type CanaryStrategy struct {
+	// Cluster names in the format "ClusterName.UserName", same as targetCluster.
+	Clusters []string `json:"clusters"`
+
+	// How long the canary clusters must stay healthy before the change is promoted.
+	// Defaults to 5m.
+	//+optional
+	BakeTime *metav1.Duration `json:"bakeTime,omitempty"`
+
+	// The analysis fails if the pods of the Deployment on a canary cluster
+	// have restarted more than this number of times in total.
+	// Defaults to 3.
+	//+optional
+	MaxRestarts *int32 `json:"maxRestarts,omitempty"`
+}
+
+type RolloutWave struct {
+	//+optional
+	Name string `json:"name,omitempty"`
+
+	// Cluster names in the format "ClusterName.UserName", same as targetCluster.
+	//+optional
+	Clusters []string `json:"clusters,omitempty"`
+
+	// Selects clusters by the labels of their ClusterDetectors.
+	//+optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+}
+
+// DeletionPolicy describes how the replicated resources are finalized.
+// +kubebuilder:validation:Enum=Delete;Orphan;Retain
+type DeletionPolicy string
+
+const (
+	// Delete removes the replicated resources and the replication namespace.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+
+	// Orphan leaves the replicated resources and the replication namespace running,
+	// but strips the labels and owner references set by plumber.
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+
+	// Retain leaves the replicated resources and the replication namespace as they are.
+	// On the primary cluster the owner references are still removed,
+	// otherwise the garbage collector would delete the resources together with the Replicator.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+)
+
+type ClusterDeletionPolicy struct {
+	// Cluster name in the format "ClusterName.UserName", same as targetCluster.
+	Cluster string         `json:"cluster"`
+	Policy  DeletionPolicy `json:"policy"`
 }
 
 // ReplicatorStatus defines the observed state of Replicator
@@ -112,9 +270,301 @@ type ReplicatorStatus struct {
 	Applied []PerResourceApplyStatus `json:"applied"`
 
 	// The status will be as follows
-	// synced: Resource Apply succeeded on all clusters
-	// not synced: Resource Apply failed in any of the clusters.
+	// Synced: Resource Apply succeeded on all clusters
+	// Degraded: Resource Apply succeeded on at least .spec.syncPolicy.minSuccessfulClusters, but not on all clusters,
+	// or the rollout has not completed yet
+	// Failed: Resource Apply succeeded on fewer clusters, or failed on the primary cluster
 	Synced string `json:"synced"`
+
+	// Number of clusters by the result of the last replication.
+	//+optional
+	SucceededClusters int32 `json:"succeededClusters,omitempty"`
+	//+optional
+	FailedClusters int32 `json:"failedClusters,omitempty"`
+	//+optional
+	SkippedClusters int32 `json:"skippedClusters,omitempty"`
+
+	// Synchronization status and time taken per cluster
+	//+optional
+	Clusters []ClusterSyncStatus `json:"clusters,omitempty"`
+
+	// Secondary clusters whose cleanup has not yet succeeded while the Replicator is being deleted.
+	//+optional
+	PendingCleanups []PendingCleanup `json:"pendingCleanups,omitempty"`
+
+	// Value of the sync-now annotation that was last handled.
+	//+optional
+	LastHandledSyncNow string `json:"lastHandledSyncNow,omitempty"`
+
+	// Result of the last preview when .spec.dryRun is set.
+	//+optional
+	DryRun *DryRunStatus `json:"dryRun,omitempty"`
+
+	// Progress of the rollout when .spec.rollout is set.
+	//+optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+
+	// Health of the workload across all clusters, as read back after the last sync.
+	//+optional
+	Health *FleetHealth `json:"health,omitempty"`
+
+	// Revision of the spec that was last synced to all clusters.
+	//+optional
+	CurrentRevision int64 `json:"currentRevision,omitempty"`
+
+	// Revisions kept in the history, oldest first.
+	//+optional
+	Revisions []int64 `json:"revisions,omitempty"`
+
+	// Generation of the Replicator that was last synced.
+	//+optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Ready: The Replicator is synced to all clusters, its rollout has completed and it is not suspended
+	// Synced: The resources were applied to all clusters
+	// Progressing: A rollout is in progress
+	// Degraded: The resources were applied to enough clusters to meet .spec.syncPolicy.minSuccessfulClusters, but not to all
+	//+optional
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types of a Replicator.
+const (
+	ReplicatorConditionReady       = "Ready"
+	ReplicatorConditionSynced      = "Synced"
+	ReplicatorConditionProgressing = "Progressing"
+	ReplicatorConditionDegraded    = "Degraded"
+)
+
+// Sync state of a Replicator.
+const (
+	SyncStateSynced   = "Synced"
+	SyncStateDegraded = "Degraded"
+	SyncStateFailed   = "Failed"
+)
+
+// What an apply would do to a resource.
+const (
+	DryRunActionCreate    = "Create"
+	DryRunActionChange    = "Change"
+	DryRunActionUnchanged = "Unchanged"
+	DryRunActionRejected  = "Rejected"
+)
+
+type DryRunStatus struct {
+	// Generation of the Replicator that was previewed.
+	ObservedGeneration int64 `json:"observedGeneration"`
+
+	// Result per cluster and resource, sorted by cluster.
+	//+optional
+	Results []DryRunResult `json:"results,omitempty"`
+}
+
+type DryRunResult struct {
+	Cluster string `json:"cluster"`
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+
+	// Create: The resource does not exist and would be created
+	// Change: The resource would be changed as shown in diff
+	// Unchanged: The resource is already up to date
+	// Rejected: The cluster rejected the apply, e.g. by validation or an admission webhook
+	Action string `json:"action"`
+
+	// Difference of the fields managed by plumber, before and after the apply.
+	//+optional
+	Diff string `json:"diff,omitempty"`
+
+	// Reason for the rejection.
+	//+optional
+	Message string `json:"message,omitempty"`
+}
+
+// Phase of a rollout.
+const (
+	RolloutPhaseProgressing = "Progressing"
+	RolloutPhasePaused      = "Paused"
+	RolloutPhaseCompleted   = "Completed"
+	RolloutPhaseRolledBack  = "RolledBack"
+)
+
+// Phase of the canary analysis.
+const (
+	CanaryPhaseBaking   = "Baking"
+	CanaryPhasePromoted = "Promoted"
+	CanaryPhaseFailed   = "Failed"
+)
+
+// Rollout state of a cluster.
+const (
+	ClusterRolloutStatePending     = "Pending"
+	ClusterRolloutStateProgressing = "Progressing"
+	ClusterRolloutStateAvailable   = "Available"
+	ClusterRolloutStateFailed      = "Failed"
+	ClusterRolloutStateRolledBack  = "RolledBack"
+)
+
+type RolloutStatus struct {
+	// Generation of the Replicator that is being rolled out.
+	ObservedGeneration int64 `json:"observedGeneration"`
+
+	// Progressing: The current wave is being rolled out
+	// Paused: A cluster of the current wave failed and pauseOnFailure is set
+	// Completed: All waves have been rolled out
+	// RolledBack: The canary analysis failed and the canary clusters were rolled back to the last stable spec
+	Phase string `json:"phase"`
+
+	// Index of the wave that is being rolled out.
+	// The canary clusters are wave 0 when .spec.rollout.canary is set.
+	// Equal to the number of waves when the rollout is completed.
+	CurrentWave int32 `json:"currentWave"`
+
+	// Progress of the canary analysis when .spec.rollout.canary is set.
+	//+optional
+	Canary *CanaryStatus `json:"canary,omitempty"`
+
+	// Rollout state per cluster, ordered by wave.
+	//+optional
+	Clusters []ClusterRolloutStatus `json:"clusters,omitempty"`
+}
+
+type CanaryStatus struct {
+	// Baking: The canary clusters are healthy and the bake time has not yet elapsed
+	// Promoted: The change has been promoted to the waves
+	// Failed: The canary analysis failed
+	Phase string `json:"phase"`
+
+	// Time when the Deployments of all canary clusters first became Available.
+	//+optional
+	BakeStartTime *metav1.Time `json:"bakeStartTime,omitempty"`
+
+	// Reason why the canary analysis failed.
+	//+optional
+	Message string `json:"message,omitempty"`
+}
+
+type ClusterRolloutStatus struct {
+	Cluster string `json:"cluster"`
+
+	// Index of the wave the cluster belongs to.
+	Wave int32 `json:"wave"`
+
+	// Pending: The wave of the cluster has not started yet
+	// Progressing: The Deployment is not yet Available with the new generation
+	// Available: The Deployment is Available with the new generation
+	// Failed: The replication failed or the Deployment exceeded its progress deadline
+	// RolledBack: The canary cluster was rolled back to the last stable spec
+	State string `json:"state"`
+
+	//+optional
+	Message string `json:"message,omitempty"`
+}
+
+type PendingCleanup struct {
+	Cluster string `json:"cluster"`
+
+	// Number of failed cleanup attempts.
+	Attempts int32 `json:"attempts"`
+
+	//+optional
+	LastAttemptTime *metav1.Time `json:"lastAttemptTime,omitempty"`
+
+	// Error message of the last failed attempt.
+	//+optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Result of the last replication to a cluster.
+const (
+	ClusterSyncStateApplied    = "Applied"
+	ClusterSyncStateFailed     = "Failed"
+	ClusterSyncStateSkipped    = "Skipped"
+	ClusterSyncStateDrifted    = "Drifted"
+	ClusterSyncStateRolledBack = "RolledBack"
+)
+
+type ClusterSyncStatus struct {
+	Cluster string `json:"cluster"`
+
+	// Applied: All resources were applied to the cluster
+	// Failed: Any of the resources could not be applied
+	// Skipped: The cluster was not replicated to because its circuit is open or it lacks a required capability
+	// Drifted: The Replicator is suspended and any of the resources differ from it
+	// RolledBack: The cluster was rolled back to the last stable spec because an atomic sync failed on another cluster
+	State string `json:"state"`
+
+	// Error message when the replication failed.
+	//+optional
+	Message string `json:"message,omitempty"`
+
+	// Time taken to replicate the resources to the cluster.
+	Duration metav1.Duration `json:"duration"`
+
+	// Time when the resources were last applied to the cluster.
+	//+optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// Health of the replicated workload, read back after the resources were applied.
+	//+optional
+	Workload *WorkloadHealth `json:"workload,omitempty"`
+}
+
+// Health of the workload on a cluster.
+const (
+	WorkloadHealthHealthy   = "Healthy"
+	WorkloadHealthUnhealthy = "Unhealthy"
+	WorkloadHealthUnknown   = "Unknown"
+)
+
+type WorkloadHealth struct {
+	// Healthy: All replicas of the Deployment are ready and available, and the Service has ready endpoints
+	// Unhealthy: Any of the replicas is not ready or available, or the Service has no ready endpoints
+	// Unknown: The resources could not be read back
+	State string `json:"state"`
+
+	// Reason why the workload is not healthy.
+	//+optional
+	Message string `json:"message,omitempty"`
+
+	// Desired, ready and available replicas of the Deployment.
+	Replicas          int32 `json:"replicas"`
+	ReadyReplicas     int32 `json:"readyReplicas"`
+	AvailableReplicas int32 `json:"availableReplicas"`
+
+	// Ready and not ready addresses of the Service endpoints.
+	//+optional
+	ReadyEndpoints int32 `json:"readyEndpoints,omitempty"`
+	//+optional
+	NotReadyEndpoints int32 `json:"notReadyEndpoints,omitempty"`
+
+	// IPs or hostnames assigned to the Ingress by the load balancer.
+	//+optional
+	IngressAddresses []string `json:"ingressAddresses,omitempty"`
+}
+
+// Health of the workload across all clusters.
+const (
+	FleetHealthHealthy   = "Healthy"
+	FleetHealthDegraded  = "Degraded"
+	FleetHealthUnhealthy = "Unhealthy"
+)
+
+type FleetHealth struct {
+	// Healthy: The workload is healthy on all clusters
+	// Degraded: The workload is healthy on some of the clusters
+	// Unhealthy: The workload is healthy on none of the clusters
+	State string `json:"state"`
+
+	// Number of clusters on which the workload is healthy, out of all clusters.
+	HealthyClusters int32 `json:"healthyClusters"`
+	Clusters        int32 `json:"clusters"`
+
+	// Sum of the replicas of the Deployment over all clusters.
+	Replicas          int32 `json:"replicas"`
+	ReadyReplicas     int32 `json:"readyReplicas"`
+	AvailableReplicas int32 `json:"availableReplicas"`
 }
 
 type PerResourceApplyStatus struct {
@@ -122,12 +572,23 @@ type PerResourceApplyStatus struct {
 	Kind        string `json:"kind"`
 	Name        string `json:"name"`
 	ApplyStatus string `json:"applyStatus"`
+
+	// Error message when the apply failed.
+	//+optional
+	Message string `json:"message,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:resource:scope=Cluster,shortName=rep
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="SYNCED",type="string",JSONPath=".status.synced"
+//+kubebuilder:printcolumn:name="SUCCEEDED",type="integer",JSONPath=".status.succeededClusters"
+//+kubebuilder:printcolumn:name="FAILED",type="integer",JSONPath=".status.failedClusters"
+//+kubebuilder:printcolumn:name="SKIPPED",type="integer",JSONPath=".status.skippedClusters"
+//+kubebuilder:printcolumn:name="HEALTH",type="string",JSONPath=".status.health.state"
+//+kubebuilder:printcolumn:name="REVISION",type="integer",priority=1,JSONPath=".status.currentRevision"
+//+kubebuilder:printcolumn:name="ROLLOUT",type="string",JSONPath=".status.rollout.phase"
+//+kubebuilder:printcolumn:name="SUSPENDED",type="boolean",JSONPath=".spec.suspend"
 //+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 
 // Replicator is the Schema for the replicators API
@@ -14,24 +14,42 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
 	"github.com/jnytnai0613/plumber/internal/controllers"
+	"github.com/jnytnai0613/plumber/pkg/circuitbreaker"
 	"github.com/jnytnai0613/plumber/pkg/client"
 	cli "github.com/jnytnai0613/plumber/pkg/client"
 	"github.com/jnytnai0613/plumber/pkg/constants"
 	"github.com/jnytnai0613/plumber/pkg/kubeconfig"
+	"github.com/jnytnai0613/plumber/pkg/tracing"
 )
 
 var (
-	enableLeaderElection bool
-	metricsAddr          string
-	probeAddr            string
-	scheme               = runtime.NewScheme()
-	setupLog             = ctrl.Log.WithName("setup")
+	circuitCooldown         time.Duration
+	circuitMaxCooldown      time.Duration
+	circuitThreshold        int
+	clusterTimeout          time.Duration
+	enableLeaderElection    bool
+	maxConcurrentClusters   int
+	maxConcurrentReconciles int
+	metricsAddr             string
+	otlpEndpoint            string
+	primaryAuthInfo         string
+	primaryCluster          string
+	otlpInsecure            bool
+	probeAddr               string
+	probeFailureThreshold   int32
+	probeInterval           time.Duration
+	probeSuccessThreshold   int32
+	replicationRunTTL       time.Duration
+	traceSampleRatio        float64
+	scheme                  = runtime.NewScheme()
+	setupLog                = ctrl.Log.WithName("setup")
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -51,6 +69,30 @@ var rootCmd = &cobra.Command{
 func sub() error {
 	var resyncPeriod = time.Second * 30
 
+	// The primary cluster is set up after the flags have been parsed,
+	// since its identity is given by them.
+	if err := setupPrimaryCluster(); err != nil {
+		return err
+	}
+
+	// Spans are only exported if an OTLP endpoint is given.
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Endpoint:    otlpEndpoint,
+		Insecure:    otlpInsecure,
+		SampleRatio: traceSampleRatio,
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			setupLog.Error(err, "unable to flush traces")
+		}
+	}()
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		SyncPeriod:             &resyncPeriod,
@@ -76,20 +118,57 @@ func sub() error {
 		return err
 	}
 
+	// The clients of the remote clusters are cached in the registry
+	// and shared by the ClusterDetector and Replicator controllers.
+	registry := cli.NewClusterRegistry(mgr.GetClient(), mgr.GetConfig(), primaryClusterName())
+
+	// Replication failures are tracked per cluster across all Replicators.
+	// A threshold of zero disables the circuit breaker.
+	var breaker *circuitbreaker.Breaker
+	if circuitThreshold > 0 {
+		breaker = circuitbreaker.New(circuitThreshold, circuitCooldown, circuitMaxCooldown)
+	}
+
 	if err = (&controllers.ClusterDetectorReconciler{
-		Client: mgr.GetClient(),
+		Client:   mgr.GetClient(),
+		Registry: registry,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterDetector")
 		return err
 	}
+	// The health of every cluster is checked on its own schedule, independently of the reconciles.
+	if err = mgr.Add(&controllers.ClusterProber{
+		Client:           mgr.GetClient(),
+		Registry:         registry,
+		Breaker:          breaker,
+		Log:              ctrl.Log.WithName("prober"),
+		Interval:         probeInterval,
+		FailureThreshold: probeFailureThreshold,
+		SuccessThreshold: probeSuccessThreshold,
+	}); err != nil {
+		setupLog.Error(err, "unable to add cluster prober")
+		return err
+	}
 	if err = (&controllers.ReplicatorReconciler{
-		Client:   mgr.GetClient(),
-		Recorder: mgr.GetEventRecorderFor("replicator-controller"),
-		Scheme:   mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Breaker:                 breaker,
+		Clientsets:              registry,
+		ClusterTimeout:          clusterTimeout,
+		MaxConcurrentClusters:   maxConcurrentClusters,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		Recorder:                mgr.GetEventRecorderFor("replicator-controller"),
+		Scheme:                  mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Replicator")
 		return err
 	}
+	if err = (&controllers.ReplicationRunReconciler{
+		Client: mgr.GetClient(),
+		TTL:    replicationRunTTL,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ReplicationRun")
+		return err
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -147,12 +226,127 @@ func init() {
 			"Enabling this will ensure there is only one active controller manager.",
 	)
 
+	cmdFlag.IntVar(
+		&maxConcurrentReconciles,
+		"max-concurrent-reconciles",
+		1,
+		"The maximum number of Replicators that are reconciled concurrently.",
+	)
+
+	cmdFlag.IntVar(
+		&maxConcurrentClusters,
+		"max-concurrent-clusters",
+		10,
+		"The maximum number of secondary clusters that a Replicator is replicated to concurrently.",
+	)
+
+	cmdFlag.DurationVar(
+		&clusterTimeout,
+		"cluster-timeout",
+		30*time.Second,
+		"The time limit for replicating a Replicator to, and checking it on, a single secondary cluster. Zero means no limit.",
+	)
+
+	cmdFlag.IntVar(
+		&circuitThreshold,
+		"circuit-breaker-threshold",
+		5,
+		"The number of consecutive replication failures after which a secondary cluster is skipped. Zero disables the circuit breaker.",
+	)
+
+	cmdFlag.DurationVar(
+		&circuitCooldown,
+		"circuit-breaker-cooldown",
+		30*time.Second,
+		"The time a skipped secondary cluster waits before it is probed again.",
+	)
+
+	cmdFlag.DurationVar(
+		&circuitMaxCooldown,
+		"circuit-breaker-max-cooldown",
+		10*time.Minute,
+		"The upper limit of the cooldown, which doubles every time a probe fails.",
+	)
+
+	cmdFlag.DurationVar(
+		&replicationRunTTL,
+		"replication-run-ttl",
+		7*24*time.Hour,
+		"The time a ReplicationRun is kept after its sync has completed. Zero keeps ReplicationRuns until their Replicator is deleted.",
+	)
+
+	cmdFlag.DurationVar(
+		&probeInterval,
+		"cluster-probe-interval",
+		10*time.Second,
+		"The interval at which the health of each cluster is checked.",
+	)
+
+	cmdFlag.Int32Var(
+		&probeFailureThreshold,
+		"cluster-probe-failure-threshold",
+		3,
+		"The number of consecutive failed health checks after which a running cluster is reported as UNKNOWN.",
+	)
+
+	cmdFlag.Int32Var(
+		&probeSuccessThreshold,
+		"cluster-probe-success-threshold",
+		1,
+		"The number of consecutive successful health checks after which a cluster is reported as RUNNING again.",
+	)
+
+	cmdFlag.StringVar(
+		&primaryCluster,
+		"primary-cluster",
+		constants.ClusterName,
+		"The name of the cluster entry of the primary cluster in the kubeconfig Secret. "+
+			"It must differ from the cluster names of the secondary clusters.",
+	)
+
+	cmdFlag.StringVar(
+		&primaryAuthInfo,
+		"primary-user",
+		constants.AuthInfo,
+		"The name of the user entry of the primary cluster in the kubeconfig Secret. "+
+			"The ClusterDetector of the primary cluster is named <primary-cluster>.<primary-user>.",
+	)
+
+	cmdFlag.StringVar(
+		&otlpEndpoint,
+		"otlp-endpoint",
+		"",
+		"The host:port of the OTLP gRPC receiver that traces are exported to. If empty, no traces are exported.",
+	)
+
+	cmdFlag.BoolVar(
+		&otlpInsecure,
+		"otlp-insecure",
+		false,
+		"Connect to the OTLP receiver without TLS.",
+	)
+
+	cmdFlag.Float64Var(
+		&traceSampleRatio,
+		"trace-sample-ratio",
+		1,
+		"The fraction of reconciles that are traced, between 0 and 1.",
+	)
+
 	opts := zap.Options{
 		Development: true,
 	}
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+}
+
+// The primary cluster is registered under this name.
+func primaryClusterName() string {
+	return kubeconfig.ClusterIdentity(&clientcmdapi.Context{Cluster: primaryCluster, AuthInfo: primaryAuthInfo})
+}
 
+// Register the primary cluster in the kubeconfig Secret and create the ClusterDetectors.
+func setupPrimaryCluster() error {
 	// Use the credentials in the Controller Pod's ServiceAccount to generate clients.
 	// Used for the following purposes
 	// - Initialization of ClusterDetector resource
@@ -161,7 +355,7 @@ func init() {
 	localClient, restConfig, err := cli.CreateLocalClient(setupLog, *scheme)
 	if err != nil {
 		setupLog.Error(err, "Failed to create local client.")
-		os.Exit(1)
+		return err
 	}
 
 	// Create a kubeconfig file for the primary cluster.
@@ -169,14 +363,14 @@ func init() {
 	clientset, err := client.CreateClientSetFromRestConfig(restConfig)
 	if err != nil {
 		setupLog.Error(err, "Failed to create clientset.")
-		os.Exit(1)
+		return err
 	}
 
 	// Generate a kubeconfig file for the primary cluster.
-	primaryConfig, err := kubeconfig.GeneratePrimaryConfig(clientset, restConfig)
+	primaryConfig, err := kubeconfig.GeneratePrimaryConfig(clientset, restConfig, primaryCluster, primaryAuthInfo)
 	if err != nil {
 		setupLog.Error(err, "Failed to generate primary config.")
-		os.Exit(1)
+		return err
 	}
 
 	// Create a clientset for the primary cluster.
@@ -190,16 +384,23 @@ func init() {
 		primaryConfig,
 	); err != nil {
 		setupLog.Error(err, "Failed to apply namespaced secret.")
-		os.Exit(1)
+		return err
 	}
 
 	setupLog.Info("Initializing ClusterDetector resources")
 	// Initialization of ClusterDetector resource
-	if err = controllers.SetupClusterDetector(localClient, setupLog); err != nil {
+	config, err := kubeconfig.ReadKubeconfigFromClient(localClient)
+	if err == nil {
+		registry := cli.NewClusterRegistry(localClient, restConfig, primaryClusterName())
+		err = controllers.SetupClusterDetector(localClient, config, registry, setupLog)
+	}
+	if err != nil {
 		if !errors.IsNotFound(err) {
 			setupLog.Error(err, "Failed to initialize ClusterDetector.")
-			os.Exit(1)
+			return err
 		}
 	}
 	setupLog.Info("Initialization of all ClusterDetector resources completed")
+
+	return nil
 }
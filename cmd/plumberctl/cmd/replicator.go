@@ -0,0 +1,45 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/client"
+	"github.com/jnytnai0613/plumber/pkg/kubeconfig"
+)
+
+// Modify the Replicator with mutate and send the difference as a merge patch.
+func patchReplicator(name string, mutate func(replicator *plumberv1.Replicator)) error {
+	// Get path and cluster from activated file
+	config, err := kubeconfig.GetPathAndCluster()
+	if err != nil {
+		return err
+	}
+
+	kubeClient, err := client.CreateClientFromContext(config.Path, config.Cluster)
+	if err != nil {
+		return err
+	}
+
+	var (
+		ctx        = context.Background()
+		replicator plumberv1.Replicator
+	)
+	if err := kubeClient.Get(ctx, crclient.ObjectKey{Name: name}, &replicator); err != nil {
+		return fmt.Errorf("failed to get Replicator %s: %w", name, err)
+	}
+
+	patch := crclient.MergeFrom(replicator.DeepCopy())
+	mutate(&replicator)
+	if err := kubeClient.Patch(ctx, &replicator, patch); err != nil {
+		return fmt.Errorf("failed to patch Replicator %s: %w", name, err)
+	}
+
+	return nil
+}
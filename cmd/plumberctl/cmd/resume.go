@@ -0,0 +1,35 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// resumeCmd represents the resume command
+var resumeCmd = &cobra.Command{
+	Use:   "resume <replicator>",
+	Short: "Resume applying a suspended Replicator to the clusters.",
+	Long:  "Resume applying a suspended Replicator to the clusters.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := patchReplicator(args[0], func(replicator *plumberv1.Replicator) {
+			replicator.Spec.Suspend = false
+		}); err != nil {
+			return err
+		}
+
+		fmt.Printf("Replicator %s resumed\n", args[0])
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resumeCmd)
+}
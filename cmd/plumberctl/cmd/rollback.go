@@ -0,0 +1,45 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+var toRevision int64
+
+// rollbackCmd represents the rollback command
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <replicator>",
+	Short: "Re-apply a previous revision of the Replicator to all clusters.",
+	Long: `Re-apply a previous revision of the Replicator to all clusters.
+The revisions kept in the history are shown in .status.revisions of the Replicator.
+Without --to-revision, the Replicator is rolled back to the revision before the current one.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if toRevision < 0 {
+			return fmt.Errorf("--to-revision must not be negative")
+		}
+
+		if err := patchReplicator(args[0], func(replicator *plumberv1.Replicator) {
+			replicator.Spec.RollbackTo = &plumberv1.RollbackConfig{Revision: toRevision}
+		}); err != nil {
+			return err
+		}
+
+		fmt.Printf("Rollback of Replicator %s requested\n", args[0])
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+
+	rollbackCmd.Flags().Int64Var(&toRevision, "to-revision", 0, "The revision to roll back to. Defaults to the previous revision")
+}
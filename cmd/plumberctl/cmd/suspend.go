@@ -0,0 +1,35 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// suspendCmd represents the suspend command
+var suspendCmd = &cobra.Command{
+	Use:   "suspend <replicator>",
+	Short: "Stop applying the Replicator to the clusters.",
+	Long:  "Stop applying the Replicator to the clusters. The status is still updated and shows any drift.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := patchReplicator(args[0], func(replicator *plumberv1.Replicator) {
+			replicator.Spec.Suspend = true
+		}); err != nil {
+			return err
+		}
+
+		fmt.Printf("Replicator %s suspended\n", args[0])
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(suspendCmd)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/constants"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync <replicator>",
+	Short: "Sync the Replicator to the clusters immediately.",
+	Long:  "Sync the Replicator to the clusters immediately. A suspended Replicator is synced once and stays suspended.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := patchReplicator(args[0], func(replicator *plumberv1.Replicator) {
+			annotations := replicator.GetAnnotations()
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[constants.SyncNowAnnotation] = time.Now().Format(time.RFC3339Nano)
+			replicator.SetAnnotations(annotations)
+		}); err != nil {
+			return err
+		}
+
+		fmt.Printf("Sync of Replicator %s requested\n", args[0])
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+}
@@ -23,11 +23,17 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/go-logr/logr"
 
+	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -38,23 +44,22 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	cli "github.com/jnytnai0613/plumber/pkg/client"
 	"github.com/jnytnai0613/plumber/pkg/constants"
 	"github.com/jnytnai0613/plumber/pkg/healthcheck"
 	"github.com/jnytnai0613/plumber/pkg/kubeconfig"
+	"github.com/jnytnai0613/plumber/pkg/metrics"
+	"github.com/jnytnai0613/plumber/pkg/tracing"
 )
 
 // ClusterDetectorReconciler reconciles a ClusterDetector object
 type ClusterDetectorReconciler struct {
 	client.Client
+	Registry *cli.ClusterRegistry
 }
 
-// NewClusterDetectorReconciler returns a new ClusterDetectorReconciler
-func RemoveClusterDetector(localClient client.Client, log logr.Logger) error {
-	config, err := kubeconfig.ReadKubeconfigFromClient(localClient)
-	if err != nil {
-		return fmt.Errorf("failed to read kubeconfig: %w", err)
-	}
-
+// Remove ClusterDetectors whose context no longer exists in the kubeconfig.
+func RemoveClusterDetector(localClient client.Client, config *clientcmdapi.Config, log logr.Logger) error {
 	ctx := context.Background()
 
 	var currentClusterDetectorList plumberv1.ClusterDetectorList
@@ -78,6 +83,7 @@ func RemoveClusterDetector(localClient client.Client, log logr.Logger) error {
 			if err := localClient.Delete(ctx, &clusterDetector); err != nil {
 				return fmt.Errorf("failed to delete ClusterDetector: %w", err)
 			}
+			metrics.DeleteCluster(clusterDetector.GetName())
 			log.Info(fmt.Sprintf("[ClusterDetector: %s] Deleted.", clusterDetector.GetName()))
 		}
 	}
@@ -85,25 +91,88 @@ func RemoveClusterDetector(localClient client.Client, log logr.Logger) error {
 	return nil
 }
 
-// Create a Custom Resource ClusterDetector and register the remote cluster status.
-func SetupClusterDetector(localClient client.Client, log logr.Logger) error {
-	config, err := kubeconfig.ReadKubeconfigFromClient(localClient)
-	if err != nil {
-		return fmt.Errorf("failed to read kubeconfig: %w", err)
+// Resources that plumber must be allowed to manage on every cluster.
+var requiredAccess = []authorizationv1.ResourceAttributes{
+	{Verb: "create", Resource: "namespaces"},
+	{Verb: "patch", Resource: "configmaps"},
+	{Verb: "patch", Resource: "secrets"},
+	{Verb: "patch", Resource: "services"},
+	{Verb: "patch", Group: "apps", Resource: "deployments"},
+	{Verb: "patch", Group: "networking.k8s.io", Resource: "ingresses"},
+}
+
+// Check whether the credentials of the cluster are allowed to manage the replicated resources.
+// A SelfSubjectAccessReview is created for each of the required resources.
+// Whether the credentials are accepted at all is known from the health checks of the ClusterProber,
+// which are authenticated with the same credentials.
+func checkClusterAccess(ctx context.Context, clientSet kubernetes.Interface) metav1.Condition {
+	authorized := metav1.Condition{
+		Type:   plumberv1.ClusterDetectorConditionAuthorized,
+		Status: metav1.ConditionUnknown,
 	}
 
-	ctx := context.Background()
+	for _, attributes := range requiredAccess {
+		attributes := attributes
+		review, err := clientSet.AuthorizationV1().SelfSubjectAccessReviews().Create(
+			ctx,
+			&authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+			},
+			metav1.CreateOptions{},
+		)
+		if err != nil {
+			authorized.Reason = "AccessReviewFailed"
+			authorized.Message = err.Error()
+			return authorized
+		}
+		if !review.Status.Allowed {
+			resource := attributes.Resource
+			if attributes.Group != "" {
+				resource = fmt.Sprintf("%s.%s", attributes.Resource, attributes.Group)
+			}
+			authorized.Status, authorized.Reason = metav1.ConditionFalse, "AccessDenied"
+			authorized.Message = fmt.Sprintf("not allowed to %s %s", attributes.Verb, resource)
+			return authorized
+		}
+	}
+
+	authorized.Status, authorized.Reason = metav1.ConditionTrue, "AccessAllowed"
+
+	return authorized
+}
+
+// Create a Custom Resource ClusterDetector and register the remote cluster status.
+// The clientsets of the registry are used to check the credentials of running clusters.
+func SetupClusterDetector(
+	localClient client.Client,
+	config *clientcmdapi.Config,
+	registry *cli.ClusterRegistry,
+	log logr.Logger,
+) error {
+	var (
+		ctx         = context.Background()
+		primaryName = registry.PrimaryClusterName()
+		duplicates  = kubeconfig.DuplicateClusterIdentities(config)
+	)
 
+	roles := map[string]int{"primary": 0, "secondary": 0}
 	for ctxName, detectCtx := range config.Contexts {
 		clusterDetector := &plumberv1.ClusterDetector{}
 		clusterDetector.SetNamespace(constants.Namespace)
-		// .Metadata.Name must be a lowercase RFC 1123 subdomain must consist of lower case alphanumeric
-		// characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com',
-		// regex used for validation is [a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*').
-		//
-		// If ContextName is put in .Metadata.Name, it will be trapped by the above restriction,
-		// so the format is "ClusterName.UserName".
-		clusterDetector.SetName(fmt.Sprintf("%s.%s", detectCtx.Cluster, detectCtx.AuthInfo))
+		// The format is "ClusterName.UserName", see kubeconfig.ClusterIdentity.
+		clusterDetector.SetName(kubeconfig.ClusterIdentity(detectCtx))
+
+		// Contexts with the same cluster and user cannot be told apart.
+		// Only the primary context may keep the identity of the primary cluster,
+		// so that a secondary cluster with the same names is not mistaken for it.
+		if contexts, ok := duplicates[clusterDetector.GetName()]; ok &&
+			(clusterDetector.GetName() != primaryName || ctxName != constants.PrimaryContext) {
+			log.Error(
+				fmt.Errorf("contexts %s have the same cluster and user", strings.Join(contexts, ", ")),
+				fmt.Sprintf("[ClusterDetector: %s] Skipped context %s.", clusterDetector.GetName(), ctxName),
+			)
+			continue
+		}
 
 		/////////////////////////////
 		// CreateOrUpdate ClusterDetector
@@ -111,32 +180,30 @@ func SetupClusterDetector(localClient client.Client, log logr.Logger) error {
 
 		// Determine the role of the cluster.
 		// The local cluster is the primary and the others are the workers.
-		role := make(map[string]string)
-		if clusterDetector.GetName() == fmt.Sprintf("%s.%s", constants.ClusterName, constants.AuthInfo) {
-			role["app.kubernetes.io/role"] = "primary"
-		} else {
-			role["app.kubernetes.io/role"] = "secondary"
-		}
-
+		// .spec.primary is only set when the ClusterDetector is created,
+		// afterwards it decides the primary cluster, e.g. when --primary-cluster is changed.
+		// The role label and the metrics follow .spec.primary.
 		if op, err := ctrl.CreateOrUpdate(ctx, localClient, clusterDetector, func() error {
-			clusterDetector.Labels = role
 			clusterDetector.Spec.Context = ctxName
 			clusterDetector.Spec.Cluster = detectCtx.Cluster
 			clusterDetector.Spec.User = detectCtx.AuthInfo
+			if clusterDetector.GetResourceVersion() == "" {
+				clusterDetector.Spec.Primary = clusterDetector.GetName() == primaryName
+			}
+			clusterDetector.Labels = map[string]string{"app.kubernetes.io/role": clusterRole(*clusterDetector)}
 			return nil
 		}); op != controllerutil.OperationResultNone {
 			log.Info(fmt.Sprintf("[ClusterDetector: %s] %s", clusterDetector.GetName(), op))
 		} else if err != nil {
 			return fmt.Errorf("failed to create or update ClusterDetector: %w", err)
 		}
+		roles[clusterRole(*clusterDetector)]++
 
 		/////////////////////////////
 		// Update Status
 		/////////////////////////////
-		var (
-			currentClusterStatus string
-			nextClusterStatus    string
-		)
+		// The health of the cluster is checked by the ClusterProber.
+		// The credentials are only checked on clusters that it reports as RUNNING.
 		if err := localClient.Get(
 			ctx,
 			client.ObjectKey{
@@ -150,54 +217,121 @@ func SetupClusterDetector(localClient client.Client, log logr.Logger) error {
 				return fmt.Errorf("failed to get ClusterDetector: %w", err)
 			}
 		}
-		currentClusterStatus = clusterDetector.Status.ClusterStatus
-
-		// Check if the remote cluster is alive.
-		nextClusterStatus = "RUNNING"
-		if err := healthcheck.HealthChecks(*config.Clusters[detectCtx.Cluster]); err != nil {
-			clusterDetector.Status.Reason = fmt.Sprintf("%s", err)
-			if currentClusterStatus != "UNKNOWN" {
-				log.Error(err, fmt.Sprintf("[Cluster: %s] Health Check failed.", detectCtx.Cluster))
+
+		authenticated := metav1.Condition{
+			Type:   plumberv1.ClusterDetectorConditionAuthenticated,
+			Status: metav1.ConditionUnknown,
+			Reason: "Unreachable",
+		}
+		authorized := metav1.Condition{
+			Type:   plumberv1.ClusterDetectorConditionAuthorized,
+			Status: metav1.ConditionUnknown,
+			Reason: "Unreachable",
+		}
+		switch {
+		case clusterDetector.Status.Health == string(healthcheck.StateUnauthorized):
+			// The health check is authenticated with the credentials of the cluster.
+			authenticated.Status, authenticated.Reason, authenticated.Message =
+				metav1.ConditionFalse, "Unauthorized", clusterDetector.Status.Reason
+			authorized.Reason = "NotAuthenticated"
+		case clusterDetector.Status.ClusterStatus == clusterStatusRunning:
+			// The cluster is not probed again here, a running cluster has passed the authenticated health checks.
+			authenticated.Status, authenticated.Reason = metav1.ConditionTrue, "CredentialsAccepted"
+			if clientSet, err := registry.Clientset(ctx, clusterDetector.GetName()); err != nil {
+				authorized.Reason, authorized.Message = "ClientsetFailed", err.Error()
+			} else {
+				authorized = checkClusterAccess(ctx, clientSet)
 			}
-			nextClusterStatus = "UNKNOWN"
 		}
-		clusterDetector.Status.ClusterStatus = nextClusterStatus
+		clusterDetector.Status.ObservedGeneration = clusterDetector.GetGeneration()
+		for _, condition := range []metav1.Condition{authenticated, authorized} {
+			condition.ObservedGeneration = clusterDetector.GetGeneration()
+			meta.SetStatusCondition(&clusterDetector.Status.Conditions, condition)
+		}
 		if err := localClient.Status().Update(ctx, clusterDetector); err != nil {
 			return fmt.Errorf("failed to update ClusterDetector status: %w", err)
 		}
-
-		if currentClusterStatus != nextClusterStatus {
-			log.Info(fmt.Sprintf("[ClusterDetector: %s] Status update completed.", clusterDetector.GetName()))
-		}
 	}
+	metrics.SetClusters(roles)
 
 	return nil
 }
 
+// Return the role of the cluster of the ClusterDetector, "primary" or "secondary".
+func clusterRole(clusterDetector plumberv1.ClusterDetector) string {
+	if clusterDetector.Spec.Primary {
+		return "primary"
+	}
+
+	return "secondary"
+}
+
 //+kubebuilder:rbac:groups=plumber.jnytnai0613.github.io,resources=clusterdetectors,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=plumber.jnytnai0613.github.io,resources=clusterdetectors/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=plumber.jnytnai0613.github.io,resources=clusterdetectors/finalizers,verbs=update
 //+kubebuilder:rbac:groups=core,resources=endpoints,verbs=get
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=selfsubjectaccessreviews,verbs=create
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=list
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingressclasses,verbs=list
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=list
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=list
 
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.6/pkg/reconcile
 func (r *ClusterDetectorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := tracing.Start(
+		ctx,
+		"Reconcile",
+		tracing.KindKey.String("ClusterDetector"),
+		tracing.NamespaceKey.String(req.Namespace),
+		tracing.NameKey.String(req.Name),
+	)
+	result, err := r.reconcileClusterDetectors(ctx)
+	tracing.End(span, err)
+
+	return result, err
+}
+
+func (r *ClusterDetectorReconciler) reconcileClusterDetectors(ctx context.Context) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 
+	// The reconcile is triggered by changes of the kubeconfig Secret,
+	// so the registry reloads it and rebuilds the clients of the changed clusters.
+	config, err := r.Registry.Kubeconfig(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to read kubeconfig.")
+		return ctrl.Result{}, err
+	}
+
 	// Remove ClusterDetector that is no longer needed.
-	if err := RemoveClusterDetector(r.Client, logger); err != nil {
+	if err := RemoveClusterDetector(r.Client, config, logger); err != nil {
 		logger.Error(err, "Failed to remove ClusterDetector.")
 		return ctrl.Result{}, err
 	}
 
 	// Create or Update ClusterDetector.
-	if err := SetupClusterDetector(r.Client, logger); err != nil {
+	if err := SetupClusterDetector(r.Client, config, r.Registry, logger); err != nil {
 		logger.Error(err, "Failed to initialize ClusterDetector.")
 		return ctrl.Result{}, err
 	}
 	return ctrl.Result{}, nil
 }
 
+// The ClusterProber updates the status of every ClusterDetector on each probe,
+// which must not trigger a reconcile of all clusters.
+// Only spec changes and transitions of .status.clusterStatus, after which the access is checked again, are reconciled.
+func clusterDetectorChanged() predicate.Predicate {
+	clusterStatusChanged := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			old := e.ObjectOld.(*plumberv1.ClusterDetector)
+			new := e.ObjectNew.(*plumberv1.ClusterDetector)
+			return old.Status.ClusterStatus != new.Status.ClusterStatus
+		},
+	}
+
+	return predicate.Or(predicate.GenerationChangedPredicate{}, clusterStatusChanged)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ClusterDetectorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	mapFn := handler.EnqueueRequestsFromMapFunc(
@@ -222,7 +356,7 @@ func (r *ClusterDetectorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&plumberv1.ClusterDetector{}).
+		For(&plumberv1.ClusterDetector{}, builder.WithPredicates(clusterDetectorChanged())).
 		Watches(
 			&corev1.Secret{},
 			mapFn,
@@ -0,0 +1,294 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/circuitbreaker"
+	cli "github.com/jnytnai0613/plumber/pkg/client"
+	"github.com/jnytnai0613/plumber/pkg/constants"
+	"github.com/jnytnai0613/plumber/pkg/healthcheck"
+)
+
+func TestCheckClusterAccess(t *testing.T) {
+	ctx := context.Background()
+
+	// Deployments may not be patched.
+	clientSet := k8sfake.NewSimpleClientset()
+	clientSet.PrependReactor("create", "selfsubjectaccessreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			review.Status.Allowed = review.Spec.ResourceAttributes.Resource != "deployments"
+			return true, review, nil
+		})
+
+	authorized := checkClusterAccess(ctx, clientSet)
+	if authorized.Status != metav1.ConditionFalse || authorized.Message != "not allowed to patch deployments.apps" {
+		t.Errorf("expected the Deployment access to be denied, got %v", authorized)
+	}
+	for _, action := range clientSet.Actions() {
+		if action.GetResource().Resource != "selfsubjectaccessreviews" {
+			t.Errorf("expected only access reviews, got %v", action)
+		}
+	}
+
+	// The access cannot be reviewed.
+	clientSet = k8sfake.NewSimpleClientset()
+	clientSet.PrependReactor("create", "selfsubjectaccessreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(authorizationv1.Resource("selfsubjectaccessreviews"), "", errors.New("denied"))
+		})
+
+	authorized = checkClusterAccess(ctx, clientSet)
+	if authorized.Status != metav1.ConditionUnknown || authorized.Reason != "AccessReviewFailed" {
+		t.Errorf("expected the access review to fail, got %v", authorized)
+	}
+}
+
+func TestClusterDetectorChanged(t *testing.T) {
+	var (
+		p   = clusterDetectorChanged()
+		old = &plumberv1.ClusterDetector{
+			ObjectMeta: metav1.ObjectMeta{Name: testSecondaryCluster, Generation: 1},
+			Status:     plumberv1.ClusterDetectorStatus{ClusterStatus: clusterStatusRunning},
+		}
+	)
+
+	// A probe that only records its latency is not reconciled.
+	probed := old.DeepCopy()
+	probed.Status.ProbeLatency = &metav1.Duration{Duration: time.Millisecond}
+	if p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: probed}) {
+		t.Error("expected a probe not to be reconciled")
+	}
+
+	unreachable := old.DeepCopy()
+	unreachable.Status.ClusterStatus = clusterStatusUnknown
+	if !p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: unreachable}) {
+		t.Error("expected a transition of the cluster status to be reconciled")
+	}
+
+	changed := old.DeepCopy()
+	changed.Generation = 2
+	if !p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: changed}) {
+		t.Error("expected a spec change to be reconciled")
+	}
+}
+
+type fakeRESTConfigProvider struct{}
+
+func (fakeRESTConfigProvider) RESTConfig(ctx context.Context, name string) (*rest.Config, error) {
+	return &rest.Config{Host: "https://" + name}, nil
+}
+
+func TestRecordProbe(t *testing.T) {
+	var (
+		clusterDetector plumberv1.ClusterDetector
+		now             = time.Now()
+		timeout         = &healthcheck.Error{State: healthcheck.StateUnreachable, Err: errors.New("timeout")}
+	)
+	probe := func(latency time.Duration, err error) string {
+		now = now.Add(10 * time.Second)
+		recordProbe(&clusterDetector, probeResult{time: now, latency: latency, err: err}, 3, 2)
+		return clusterDetector.Status.ClusterStatus
+	}
+
+	if s := probe(time.Millisecond, nil); s != clusterStatusRunning {
+		t.Fatalf("expected the first probe to set the status, got %s", s)
+	}
+	transition := clusterDetector.Status.LastTransitionTime
+
+	// Two timeouts do not flip the status, the third does.
+	for i := 0; i < 2; i++ {
+		if s := probe(2*time.Second, timeout); s != clusterStatusRunning {
+			t.Fatalf("timeout %d: expected the cluster to stay running, got %s", i, s)
+		}
+	}
+	if clusterDetector.Status.LastTransitionTime != transition || clusterDetector.Status.Health != "Unreachable" {
+		t.Errorf("expected only the health to change, got %+v", clusterDetector.Status)
+	}
+	if s := probe(2*time.Second, timeout); s != clusterStatusUnknown {
+		t.Fatalf("expected the third timeout to flip the status, got %s", s)
+	}
+	if clusterDetector.Status.ConsecutiveFailures != 3 || clusterDetector.Status.Reason == "" {
+		t.Errorf("expected 3 failures to be recorded, got %+v", clusterDetector.Status)
+	}
+
+	// The cluster is running again after two successful probes.
+	if s := probe(time.Millisecond, nil); s != clusterStatusUnknown {
+		t.Fatalf("expected a single success not to flip the status, got %s", s)
+	}
+	if s := probe(time.Millisecond, nil); s != clusterStatusRunning {
+		t.Fatalf("expected the second success to flip the status, got %s", s)
+	}
+
+	// The history is capped and the p95 latency is taken from it.
+	for i := 0; i < probeHistoryLength; i++ {
+		probe(time.Duration(i+1)*time.Millisecond, nil)
+	}
+	if n := len(clusterDetector.Status.ProbeHistory); n != probeHistoryLength {
+		t.Errorf("expected %d probes in the history, got %d", probeHistoryLength, n)
+	}
+	if p95 := clusterDetector.Status.ProbeLatencyP95.Duration; p95 != 10*time.Millisecond {
+		t.Errorf("expected a p95 latency of 10ms, got %s", p95)
+	}
+}
+
+func TestClusterProber(t *testing.T) {
+	const cluster = "secondary.kubernetes-admin2"
+
+	var (
+		ctx                   = context.Background()
+		scheme                = newTestScheme(t)
+		breaker               = circuitbreaker.New(1, time.Minute, time.Minute)
+		probeErr        error = &healthcheck.Error{State: healthcheck.StateTLSError, Err: errors.New("x509: unknown authority")}
+		clusterDetector       = &plumberv1.ClusterDetector{
+			ObjectMeta: metav1.ObjectMeta{Name: cluster, Namespace: constants.Namespace},
+		}
+	)
+	p := &ClusterProber{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(clusterDetector).
+			WithStatusSubresource(&plumberv1.ClusterDetector{}).
+			Build(),
+		Registry:         fakeRESTConfigProvider{},
+		Breaker:          breaker,
+		FailureThreshold: 3,
+		SuccessThreshold: 1,
+		probe: func(ctx context.Context, config *rest.Config) error {
+			return probeErr
+		},
+		collect: func(ctx context.Context, config *rest.Config) (*plumberv1.ClusterInventory, error) {
+			return &plumberv1.ClusterInventory{KubernetesVersion: "v1.27.2", Nodes: 3}, nil
+		},
+		now: time.Now,
+	}
+
+	if err := p.probeCluster(ctx, cluster); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Client.Get(ctx, client.ObjectKeyFromObject(clusterDetector), clusterDetector); err != nil {
+		t.Fatal(err)
+	}
+	if s := clusterDetector.Status; s.ClusterStatus != clusterStatusUnknown || s.Health != "TLSError" || s.LastProbeTime == nil {
+		t.Fatalf("expected the TLS error to be recorded, got %+v", s)
+	}
+	if clusterDetector.Status.Inventory != nil {
+		t.Errorf("expected no inventory of an unhealthy cluster, got %+v", clusterDetector.Status.Inventory)
+	}
+
+	// The circuit of the cluster is closed when it is running again.
+	breaker.Failure(cluster)
+	probeErr = nil
+	if err := p.probeCluster(ctx, cluster); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Client.Get(ctx, client.ObjectKeyFromObject(clusterDetector), clusterDetector); err != nil {
+		t.Fatal(err)
+	}
+	if clusterDetector.Status.ClusterStatus != clusterStatusRunning {
+		t.Fatalf("expected the cluster to be running, got %+v", clusterDetector.Status)
+	}
+	if inventory := clusterDetector.Status.Inventory; inventory == nil || inventory.KubernetesVersion != "v1.27.2" || inventory.Nodes != 3 {
+		t.Errorf("expected the inventory to be recorded, got %+v", inventory)
+	}
+	if s := breaker.State(cluster); s != circuitbreaker.StateClosed {
+		t.Errorf("expected the circuit to be closed, got %s", s)
+	}
+}
+
+func TestSetupClusterDetector(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		scheme = newTestScheme(t)
+		config = &clientcmdapi.Config{
+			Contexts: map[string]*clientcmdapi.Context{
+				constants.PrimaryContext: {Cluster: "primary-cluster", AuthInfo: "primary-admin"},
+				"secondary1":             {Cluster: "primary-cluster", AuthInfo: "primary-admin"},
+				"secondary2":             {Cluster: "kubernetes", AuthInfo: "kubernetes-admin"},
+			},
+		}
+	)
+	localClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&plumberv1.ClusterDetector{}).
+		Build()
+	// The second run has other names for the primary cluster, e.g. after --primary-cluster has been changed.
+	// .spec.primary is only set when a ClusterDetector is created, so the primary cluster does not change.
+	for _, primaryName := range []string{"primary-cluster.primary-admin", "kubernetes.kubernetes-admin"} {
+		registry := cli.NewClusterRegistry(localClient, &rest.Config{Host: "https://primary"}, primaryName)
+		if err := SetupClusterDetector(localClient, config, registry, logr.Discard()); err != nil {
+			t.Fatal(err)
+		}
+
+		clusterDetectors := &plumberv1.ClusterDetectorList{}
+		if err := localClient.List(ctx, clusterDetectors); err != nil {
+			t.Fatal(err)
+		}
+		if len(clusterDetectors.Items) != 2 {
+			t.Fatalf("expected 2 ClusterDetectors, got %d", len(clusterDetectors.Items))
+		}
+		for _, clusterDetector := range clusterDetectors.Items {
+			switch clusterDetector.GetName() {
+			case "primary-cluster.primary-admin":
+				// The secondary context with the identity of the primary cluster is skipped.
+				if !clusterDetector.Spec.Primary || clusterDetector.Spec.Context != constants.PrimaryContext {
+					t.Errorf("expected the primary context to be the primary cluster, got %+v", clusterDetector.Spec)
+				}
+				if role := clusterDetector.GetLabels()["app.kubernetes.io/role"]; role != "primary" {
+					t.Errorf("expected the primary role, got %s", role)
+				}
+			case "kubernetes.kubernetes-admin":
+				// The default names of the primary cluster do not make a secondary cluster primary.
+				if clusterDetector.Spec.Primary {
+					t.Errorf("expected a secondary cluster, got %+v", clusterDetector.Spec)
+				}
+				if role := clusterDetector.GetLabels()["app.kubernetes.io/role"]; role != "secondary" {
+					t.Errorf("expected the secondary role, got %s", role)
+				}
+			default:
+				t.Errorf("unexpected ClusterDetector %s", clusterDetector.GetName())
+			}
+		}
+	}
+}
@@ -0,0 +1,301 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/circuitbreaker"
+	cli "github.com/jnytnai0613/plumber/pkg/client"
+	"github.com/jnytnai0613/plumber/pkg/constants"
+	"github.com/jnytnai0613/plumber/pkg/healthcheck"
+	"github.com/jnytnai0613/plumber/pkg/inventory"
+	"github.com/jnytnai0613/plumber/pkg/metrics"
+)
+
+const (
+	clusterStatusRunning = "RUNNING"
+	clusterStatusUnknown = "UNKNOWN"
+
+	// Number of health check results kept in .status.probeHistory.
+	probeHistoryLength = 10
+)
+
+// ClusterProber checks the health of every cluster with a ClusterDetector on a fixed interval
+// and records the results in the status of the ClusterDetector.
+// The clusterstatus only changes after FailureThreshold failed or SuccessThreshold successful checks in a row,
+// so that a single timeout does not make the Replicators skip a cluster.
+// After every successful check, the inventory of the cluster is collected as well.
+// It is added to the manager as a Runnable, so it only runs on the leader.
+type ClusterProber struct {
+	Client           client.Client
+	Registry         cli.RESTConfigProvider
+	Breaker          *circuitbreaker.Breaker
+	Log              logr.Logger
+	Interval         time.Duration
+	FailureThreshold int32
+	SuccessThreshold int32
+
+	probe   func(ctx context.Context, config *rest.Config) error
+	collect func(ctx context.Context, config *rest.Config) (*plumberv1.ClusterInventory, error)
+	now     func() time.Time
+}
+
+// Outcome of a single health check.
+type probeResult struct {
+	time    time.Time
+	latency time.Duration
+	err     error
+
+	// Collected only if the health check succeeded.
+	inventory *plumberv1.ClusterInventory
+}
+
+// Start a prober for every ClusterDetector and stop the probers of deleted ClusterDetectors.
+// The ClusterDetectors are listed again on every interval.
+func (p *ClusterProber) Start(ctx context.Context) error {
+	if p.probe == nil {
+		p.probe = healthcheck.HealthChecks
+	}
+	if p.collect == nil {
+		p.collect = inventory.Collect
+	}
+	if p.now == nil {
+		p.now = time.Now
+	}
+
+	var (
+		wg      sync.WaitGroup
+		probers = make(map[string]context.CancelFunc)
+	)
+	defer func() {
+		for _, cancel := range probers {
+			cancel()
+		}
+		wg.Wait()
+	}()
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		var clusterDetectors plumberv1.ClusterDetectorList
+		if err := p.Client.List(ctx, &clusterDetectors, client.InNamespace(constants.Namespace)); err != nil {
+			p.Log.Error(err, "Failed to list ClusterDetectors.")
+			return
+		}
+
+		current := make(map[string]bool)
+		for _, clusterDetector := range clusterDetectors.Items {
+			name := clusterDetector.GetName()
+			current[name] = true
+			if _, ok := probers[name]; ok {
+				continue
+			}
+
+			proberCtx, cancel := context.WithCancel(ctx)
+			probers[name] = cancel
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				wait.JitterUntilWithContext(proberCtx, func(ctx context.Context) {
+					if err := p.probeCluster(ctx, name); err != nil {
+						p.Log.Error(err, fmt.Sprintf("[ClusterDetector: %s] Failed to record health check.", name))
+					}
+				}, p.Interval, 0.1, true)
+			}()
+		}
+
+		for name, cancel := range probers {
+			if !current[name] {
+				cancel()
+				delete(probers, name)
+			}
+		}
+	}, p.Interval)
+
+	return nil
+}
+
+// Check the health of the cluster and record the result in its ClusterDetector.
+func (p *ClusterProber) probeCluster(ctx context.Context, name string) error {
+	start := p.now()
+	config, err := p.Registry.RESTConfig(ctx, name)
+	if err == nil {
+		err = p.probe(ctx, config)
+	}
+	result := probeResult{time: start, latency: p.now().Sub(start), err: err}
+	if err == nil {
+		// Whatever could be collected is recorded, the rest is left empty until the next check.
+		result.inventory, err = p.collect(ctx, config)
+		if err != nil {
+			p.Log.Error(err, fmt.Sprintf("[ClusterDetector: %s] Failed to collect inventory.", name))
+		}
+	}
+
+	var (
+		previous string
+		next     string
+	)
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var clusterDetector plumberv1.ClusterDetector
+		if err := p.Client.Get(
+			ctx,
+			client.ObjectKey{Namespace: constants.Namespace, Name: name},
+			&clusterDetector,
+		); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		previous = clusterDetector.Status.ClusterStatus
+		recordProbe(&clusterDetector, result, p.FailureThreshold, p.SuccessThreshold)
+		next = clusterDetector.Status.ClusterStatus
+
+		return p.Client.Status().Update(ctx, &clusterDetector)
+	}); err != nil {
+		return fmt.Errorf("failed to update ClusterDetector status: %w", err)
+	}
+	if next == "" {
+		return nil
+	}
+	metrics.SetClusterHealthy(name, next == clusterStatusRunning)
+
+	if previous != next {
+		if next == clusterStatusRunning {
+			p.Log.Info(fmt.Sprintf("[ClusterDetector: %s] Cluster is running.", name))
+		} else {
+			p.Log.Error(result.err, fmt.Sprintf("[ClusterDetector: %s] Health Check failed.", name))
+		}
+
+		// Give the Replicators a chance to replicate to the recovered cluster right away.
+		if next == clusterStatusRunning && p.Breaker.State(name) != circuitbreaker.StateClosed {
+			p.Breaker.Reset(name)
+			p.Log.Info(fmt.Sprintf("[ClusterDetector: %s] Circuit closed.", name))
+		}
+	}
+
+	return nil
+}
+
+// Record the result of a health check in the status of the ClusterDetector.
+// The first check sets the clusterstatus right away.
+// After that, it changes only after failureThreshold failed or successThreshold successful checks in a row.
+func recordProbe(
+	clusterDetector *plumberv1.ClusterDetector,
+	result probeResult,
+	failureThreshold int32,
+	successThreshold int32,
+) {
+	var (
+		status = &clusterDetector.Status
+		health = healthcheck.StateOf(result.err)
+		now    = metav1.NewTime(result.time)
+	)
+
+	status.LastProbeTime = &now
+	status.ProbeLatency = &metav1.Duration{Duration: result.latency}
+	status.Health = string(health)
+	status.ProbeHistory = append(status.ProbeHistory, plumberv1.ProbeResult{
+		Time:    now,
+		Health:  string(health),
+		Latency: metav1.Duration{Duration: result.latency},
+	})
+	if len(status.ProbeHistory) > probeHistoryLength {
+		status.ProbeHistory = status.ProbeHistory[len(status.ProbeHistory)-probeHistoryLength:]
+	}
+	status.ProbeLatencyP95 = &metav1.Duration{Duration: latencyPercentile(status.ProbeHistory, 0.95)}
+	if result.inventory != nil {
+		status.Inventory = result.inventory
+	}
+
+	next := status.ClusterStatus
+	if result.err != nil {
+		status.ConsecutiveFailures++
+		status.ConsecutiveSuccesses = 0
+		status.Reason = result.err.Error()
+		if next == "" || status.ConsecutiveFailures >= failureThreshold {
+			next = clusterStatusUnknown
+		}
+	} else {
+		status.ConsecutiveSuccesses++
+		status.ConsecutiveFailures = 0
+		status.Reason = ""
+		if next == "" || status.ConsecutiveSuccesses >= successThreshold {
+			next = clusterStatusRunning
+		}
+	}
+
+	if next != status.ClusterStatus {
+		status.ClusterStatus = next
+		status.LastTransitionTime = &now
+	}
+
+	reachable := metav1.Condition{
+		Type:               plumberv1.ClusterDetectorConditionReachable,
+		Status:             metav1.ConditionTrue,
+		Reason:             "HealthCheckSucceeded",
+		ObservedGeneration: clusterDetector.GetGeneration(),
+	}
+	switch {
+	case status.ClusterStatus != clusterStatusRunning && result.err == nil:
+		reachable.Status, reachable.Reason = metav1.ConditionFalse, "BelowSuccessThreshold"
+	case status.ClusterStatus != clusterStatusRunning:
+		reachable.Status, reachable.Reason, reachable.Message = metav1.ConditionFalse, string(health), status.Reason
+	case result.err != nil:
+		reachable.Reason, reachable.Message = "BelowFailureThreshold", status.Reason
+	}
+	meta.SetStatusCondition(&status.Conditions, reachable)
+}
+
+// Return the latency below which the given fraction of the probes completed, using the nearest-rank method.
+func latencyPercentile(history []plumberv1.ProbeResult, percentile float64) time.Duration {
+	if len(history) == 0 {
+		return 0
+	}
+
+	latencies := make([]time.Duration, 0, len(history))
+	for _, probe := range history {
+		latencies = append(latencies, probe.Latency.Duration)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	rank := int(math.Ceil(percentile * float64(len(latencies))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return latencies[rank-1]
+}
@@ -0,0 +1,93 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// ReplicationRunReconciler deletes ReplicationRuns once their TTL has expired
+type ReplicationRunReconciler struct {
+	client.Client
+
+	// Time a ReplicationRun is kept after its sync has completed.
+	// Zero keeps ReplicationRuns until their Replicator is deleted.
+	TTL time.Duration
+
+	now func() time.Time
+}
+
+//+kubebuilder:rbac:groups=plumber.jnytnai0613.github.io,resources=replicationruns,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=plumber.jnytnai0613.github.io,resources=replicationruns/status,verbs=get;update;patch
+
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.6/pkg/reconcile
+func (r *ReplicationRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if r.TTL <= 0 {
+		return ctrl.Result{}, nil
+	}
+
+	var run plumberv1.ReplicationRun
+	if err := r.Get(ctx, req.NamespacedName, &run); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// The status is written right after the run is created,
+	// so a run without a completion time is only kept until its creation time expires.
+	completed := run.Status.CompletionTime.Time
+	if completed.IsZero() {
+		completed = run.GetCreationTimestamp().Time
+	}
+
+	now := time.Now
+	if r.now != nil {
+		now = r.now
+	}
+	if remaining := completed.Add(r.TTL).Sub(now()); remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+
+	if err := r.Delete(ctx, &run); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+	logger.Info(fmt.Sprintf("ReplicationRun expired: [run] %s", run.GetName()))
+
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ReplicationRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&plumberv1.ReplicationRun{}).
+		Complete(r)
+}
@@ -0,0 +1,139 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/multierr"
+
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// Sync the Replicator in two phases.
+// The resources are applied only after a dry run has succeeded on every cluster.
+// If an apply still fails part-way, the clusters that were updated are rolled back to the stable spec.
+func (r *ReplicatorReconciler) replicateAtomically(
+	ctx context.Context,
+	log logr.Logger,
+	req ctrl.Request,
+	replicator plumberv1.Replicator,
+	primaryClientSet map[string]kubernetes.Interface,
+	secondaryClientsets map[string]kubernetes.Interface,
+) (ReplicateResult, error) {
+	preview, err := r.Preview(ctx, log, req, replicator, primaryClientSet, secondaryClientsets)
+	if err != nil {
+		result := ReplicateResult{DryRun: preview.DryRun}
+		for _, c := range preview.Clusters {
+			if c.State == plumberv1.ClusterSyncStateFailed {
+				c.Message = fmt.Sprintf("dry run failed: %s", c.Message)
+			} else {
+				c.State = plumberv1.ClusterSyncStateSkipped
+				c.Message = "not applied, the dry run failed on another cluster"
+			}
+			result.Clusters = append(result.Clusters, c)
+		}
+
+		return result, fmt.Errorf("dry run failed, nothing was applied: %w", err)
+	}
+
+	result, err := r.Replicate(ctx, log, req, replicator, primaryClientSet, secondaryClientsets)
+	if err == nil {
+		return result, nil
+	}
+
+	stable, ok, serr := r.stableReplicator(ctx, replicator)
+	if serr != nil {
+		return result, multierr.Append(err, serr)
+	}
+	if !ok {
+		log.Info("Atomic sync failed, no stable spec to roll back to")
+		return result, err
+	}
+
+	// Only the clusters that were updated are rolled back.
+	var (
+		rollbackPrimary   = make(map[string]kubernetes.Interface)
+		rollbackSecondary = make(map[string]kubernetes.Interface)
+		rolledBack        = make(map[string]bool)
+	)
+	for _, c := range result.Clusters {
+		if c.State != plumberv1.ClusterSyncStateApplied {
+			continue
+		}
+		if clientSet, ok := primaryClientSet[c.Cluster]; ok {
+			rollbackPrimary[c.Cluster] = clientSet
+		} else if clientSet, ok := secondaryClientsets[c.Cluster]; ok {
+			rollbackSecondary[c.Cluster] = clientSet
+		}
+		rolledBack[c.Cluster] = true
+	}
+
+	log.Info(fmt.Sprintf("Atomic sync failed, rolling back: [clusters] %d", len(rolledBack)))
+	rollback, rerr := r.Replicate(ctx, log, req, stable, rollbackPrimary, rollbackSecondary)
+	if rerr != nil {
+		err = multierr.Append(err, fmt.Errorf("failed to roll back: %w", rerr))
+	}
+
+	// The status of the rolled back clusters shows the result of the rollback.
+	var applied []plumberv1.PerResourceApplyStatus
+	for _, s := range result.Applied {
+		if !rolledBack[s.Cluster] {
+			applied = append(applied, s)
+		}
+	}
+	result.Applied = append(applied, rollback.Applied...)
+	sort.SliceStable(result.Applied, func(i, j int) bool {
+		return result.Applied[i].Cluster < result.Applied[j].Cluster
+	})
+	result.Changes = append(result.Changes, rollback.Changes...)
+	sort.SliceStable(result.Changes, func(i, j int) bool {
+		return result.Changes[i].Cluster < result.Changes[j].Cluster
+	})
+
+	rollbackStates := make(map[string]plumberv1.ClusterSyncStatus)
+	for _, c := range rollback.Clusters {
+		rollbackStates[c.Cluster] = c
+	}
+	for i, c := range result.Clusters {
+		if !rolledBack[c.Cluster] {
+			continue
+		}
+		if rc, ok := rollbackStates[c.Cluster]; ok && rc.State == plumberv1.ClusterSyncStateFailed {
+			result.Clusters[i].State = plumberv1.ClusterSyncStateFailed
+			result.Clusters[i].Message = fmt.Sprintf("rollback failed: %s", rc.Message)
+			continue
+		}
+		result.Clusters[i].State = plumberv1.ClusterSyncStateRolledBack
+		result.Clusters[i].Message = "rolled back to the stable spec, the sync failed on another cluster"
+	}
+
+	return result, err
+}
@@ -0,0 +1,170 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+const (
+	defaultBakeTime    = 5 * time.Minute
+	defaultMaxRestarts = 3
+)
+
+// Check the Deployment on a canary cluster against the analysis criteria:
+// the Deployment is Available, no pod is in CrashLoopBackOff
+// and the pods have not restarted more than maxRestarts times in total.
+func analyzeCanary(
+	ctx context.Context,
+	replicator plumberv1.Replicator,
+	clientSet kubernetes.Interface,
+	maxRestarts int32,
+) error {
+	deployment, err := clientSet.AppsV1().
+		Deployments(replicator.Spec.ReplicationNamespace).
+		Get(ctx, replicator.Spec.DeploymentName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get Deployment: %w", err)
+	}
+
+	var available bool
+	for _, c := range deployment.Status.Conditions {
+		if c.Type == appsv1.DeploymentAvailable && c.Status == corev1.ConditionTrue {
+			available = true
+		}
+	}
+	if !available {
+		return fmt.Errorf("Deployment %s is not Available", deployment.GetName())
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector of Deployment %s: %w", deployment.GetName(), err)
+	}
+	pods, err := clientSet.CoreV1().
+		Pods(replicator.Spec.ReplicationNamespace).
+		List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var restarts int32
+	for _, pod := range pods.Items {
+		var statuses []corev1.ContainerStatus
+		statuses = append(statuses, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		for _, s := range statuses {
+			if s.State.Waiting != nil && s.State.Waiting.Reason == "CrashLoopBackOff" {
+				return fmt.Errorf("container %s of pod %s is in CrashLoopBackOff", s.Name, pod.GetName())
+			}
+			restarts += s.RestartCount
+		}
+	}
+	if restarts > maxRestarts {
+		return fmt.Errorf("pods restarted %d times, more than %d", restarts, maxRestarts)
+	}
+
+	return nil
+}
+
+// Analyze the canary clusters until the bake time has elapsed.
+// It returns the time to wait for the next analysis, or zero once the change can be promoted.
+func (r *ReplicatorReconciler) bakeCanary(
+	ctx context.Context,
+	replicator *plumberv1.Replicator,
+	clusters []string,
+	targets map[string]kubernetes.Interface,
+) (time.Duration, error) {
+	var (
+		canary      = replicator.Spec.Rollout.Canary
+		status      = replicator.Status.Rollout
+		bakeTime    = defaultBakeTime
+		maxRestarts = int32(defaultMaxRestarts)
+	)
+	if canary.BakeTime != nil {
+		bakeTime = canary.BakeTime.Duration
+	}
+	if canary.MaxRestarts != nil {
+		maxRestarts = *canary.MaxRestarts
+	}
+
+	if status.Canary == nil || status.Canary.BakeStartTime == nil {
+		now := metav1.Now()
+		status.Canary = &plumberv1.CanaryStatus{
+			Phase:         plumberv1.CanaryPhaseBaking,
+			BakeStartTime: &now,
+		}
+	}
+
+	for _, cluster := range clusters {
+		clusterCtx, cancel := r.clusterContext(ctx)
+		err := analyzeCanary(clusterCtx, *replicator, targets[cluster], maxRestarts)
+		cancel()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", cluster, err)
+		}
+	}
+
+	if remaining := bakeTime - time.Since(status.Canary.BakeStartTime.Time); remaining > 0 {
+		if remaining > rolloutPollInterval {
+			remaining = rolloutPollInterval
+		}
+		return remaining, nil
+	}
+
+	status.Canary.Phase = plumberv1.CanaryPhasePromoted
+
+	return 0, nil
+}
+
+// Mark the canary analysis as failed.
+// The canary clusters are rolled back if a revision has been recorded, otherwise the rollout is paused.
+func failCanary(log logr.Logger, replicator *plumberv1.Replicator, reason string) {
+	status := replicator.Status.Rollout
+	if status.Canary == nil {
+		status.Canary = &plumberv1.CanaryStatus{}
+	}
+	status.Canary.Phase = plumberv1.CanaryPhaseFailed
+	status.Canary.Message = reason
+
+	if replicator.Status.CurrentRevision == 0 {
+		status.Phase = plumberv1.RolloutPhasePaused
+		log.Info(fmt.Sprintf("Canary analysis failed, no stable spec to roll back to: %s", reason))
+		return
+	}
+
+	status.Phase = plumberv1.RolloutPhaseRolledBack
+	log.Info(fmt.Sprintf("Canary analysis failed, rolling back: %s", reason))
+}
@@ -0,0 +1,96 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// Set the conditions of the Replicator from the rest of its status.
+func setReplicatorConditions(replicator *plumberv1.Replicator, suspended bool) {
+	var (
+		status     = &replicator.Status
+		generation = replicator.GetGeneration()
+		clusters   = fmt.Sprintf("%d succeeded, %d failed, %d skipped",
+			status.SucceededClusters, status.FailedClusters, status.SkippedClusters)
+	)
+	set := func(conditionType string, ok bool, reason, message string) {
+		s := metav1.ConditionFalse
+		if ok {
+			s = metav1.ConditionTrue
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             s,
+			ObservedGeneration: generation,
+			Reason:             reason,
+			Message:            message,
+		})
+	}
+
+	applied := status.SucceededClusters > 0
+	failed := status.FailedClusters+status.SkippedClusters > 0
+	set(plumberv1.ReplicatorConditionSynced, applied && !failed, syncedReason(applied, failed), clusters)
+
+	set(plumberv1.ReplicatorConditionDegraded,
+		status.Synced == plumberv1.SyncStateDegraded,
+		status.Synced,
+		clusters)
+
+	progressing, reason := false, "NoRollout"
+	switch {
+	case suspended:
+		reason = "Suspended"
+	case status.Rollout != nil:
+		progressing = status.Rollout.Phase == plumberv1.RolloutPhaseProgressing
+		reason = "Rollout" + status.Rollout.Phase
+	}
+	set(plumberv1.ReplicatorConditionProgressing, progressing, reason, "")
+
+	switch {
+	case suspended:
+		set(plumberv1.ReplicatorConditionReady, false, "Suspended", "the Replicator is suspended")
+	default:
+		set(plumberv1.ReplicatorConditionReady,
+			status.Synced == plumberv1.SyncStateSynced,
+			status.Synced,
+			clusters)
+	}
+}
+
+func syncedReason(applied, failed bool) string {
+	switch {
+	case failed:
+		return "ClustersNotApplied"
+	case !applied:
+		return "NothingApplied"
+	}
+
+	return "AllClustersApplied"
+}
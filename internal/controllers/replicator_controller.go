@@ -26,17 +26,25 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/multierr"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkv1 "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	appsv1apply "k8s.io/client-go/applyconfigurations/apps/v1"
 	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
 	metav1apply "k8s.io/client-go/applyconfigurations/meta/v1"
@@ -46,51 +54,179 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/circuitbreaker"
 	cli "github.com/jnytnai0613/plumber/pkg/client"
 	"github.com/jnytnai0613/plumber/pkg/constants"
+	"github.com/jnytnai0613/plumber/pkg/metrics"
 	"github.com/jnytnai0613/plumber/pkg/pki"
+	"github.com/jnytnai0613/plumber/pkg/tracing"
 )
 
 // ReplicatorReconciler reconciles a Replicator object
 type ReplicatorReconciler struct {
 	client.Client
-	Recorder record.EventRecorder
-	Scheme   *runtime.Scheme
+	Breaker                 *circuitbreaker.Breaker
+	Clientsets              cli.ClientsetProvider
+	ClusterTimeout          time.Duration
+	MaxConcurrentClusters   int
+	MaxConcurrentReconciles int
+	Recorder                record.EventRecorder
+	Scheme                  *runtime.Scheme
+
+	// Time of the newest Warning event mirrored from each cluster, per Replicator.
+	mirroredMu sync.Mutex
+	mirrored   map[string]time.Time
+
+	// Time the reconciler was set up. Older events are not mirrored,
+	// since a previous instance of the controller may already have mirrored them.
+	startTime time.Time
+
+	// Generation of each Replicator that is being synced and when it was first seen.
+	generationsMu sync.Mutex
+	generations   map[types.UID]generationSync
+
+	// Time each secondary cluster was found incompatible with a Replicator,
+	// or its discovery results were last discarded while it was incompatible.
+	incompatibleMu sync.Mutex
+	incompatible   map[string]time.Time
+
+	// Outcome of the last ReplicationRun recorded for each Replicator.
+	lastRunsMu sync.Mutex
+	lastRuns   map[types.UID]string
 }
 
+// ReplicateRuntime holds the state of a single Reconcile.
+// Nothing is shared between Reconciles, so that several Replicators can be reconciled concurrently.
 type ReplicateRuntime struct {
-	ClientSet  *kubernetes.Clientset
+	ClientSet  kubernetes.Interface
 	IsPrimary  bool
 	Context    context.Context
 	Log        logr.Logger
 	Cluster    string
+	Owner      *metav1apply.OwnerReferenceApplyConfiguration
 	Replicator plumberv1.Replicator
+	Recorder   record.EventRecorder
 	Request    reconcile.Request
+	SyncStatus *syncStatus
+
+	// When set, nothing is applied and differences from the desired state are only recorded as drift.
+	Suspended bool
+
+	// When set, every apply is sent with DryRun All and its result is recorded in SyncStatus.
+	DryRun bool
+
+	// Versions served by the cluster for the kinds that are applied in more than one version.
+	Versions apiVersions
+}
+
+// Apply result of each resource collected during a single Reconcile.
+// It is shared by the clusters that are replicated concurrently.
+type syncStatus struct {
+	mu      sync.Mutex
+	applied []plumberv1.PerResourceApplyStatus
+	changed []plumberv1.PerResourceApplyStatus
+	dryRun  []plumberv1.DryRunResult
+}
+
+func (s *syncStatus) record(status plumberv1.PerResourceApplyStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.applied = append(s.applied, status)
+}
+
+// Record the result of a resource that was sent to the cluster because it differed from the desired state.
+func (s *syncStatus) recordChange(status plumberv1.PerResourceApplyStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.applied = append(s.applied, status)
+	s.changed = append(s.changed, status)
+}
+
+// Return the changed resources of the cluster.
+func (s *syncStatus) changesOf(cluster string) []plumberv1.PerResourceApplyStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed []plumberv1.PerResourceApplyStatus
+	for _, status := range s.changed {
+		if status.Cluster == cluster {
+			changed = append(changed, status)
+		}
+	}
+
+	return changed
+}
+
+// Report whether any resource of the cluster differs from the desired state.
+func (s *syncStatus) drifted(cluster string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, status := range s.applied {
+		if status.Cluster == cluster && status.ApplyStatus == applyStatusDrifted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the recorded results sorted by cluster.
+// Within a cluster, the results keep the order in which the resources were applied.
+func (s *syncStatus) sorted() []plumberv1.PerResourceApplyStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	applied := append([]plumberv1.PerResourceApplyStatus(nil), s.applied...)
+	sort.SliceStable(applied, func(i, j int) bool {
+		return applied[i].Cluster < applied[j].Cluster
+	})
+
+	return applied
+}
+
+// Return the changed resources sorted by cluster.
+func (s *syncStatus) sortedChanges() []plumberv1.PerResourceApplyStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := append([]plumberv1.PerResourceApplyStatus(nil), s.changed...)
+	sort.SliceStable(changed, func(i, j int) bool {
+		return changed[i].Cluster < changed[j].Cluster
+	})
+
+	return changed
 }
 
-var (
-	syncStatus []plumberv1.PerResourceApplyStatus
-	owner      *metav1apply.OwnerReferenceApplyConfiguration
-	replicator plumberv1.Replicator
+// Recorded instead of applying while the Replicator is suspended.
+const applyStatusDrifted = "drifted"
+
+const (
+	cleanupBaseBackoff = 5 * time.Second
+	cleanupMaxBackoff  = 5 * time.Minute
 )
 
 // Create OwnerReference with CR as Owner
 func createOwnerReferences(
 	log logr.Logger,
 	scheme *runtime.Scheme,
-) error {
-	gvk, err := apiutil.GVKForObject(&replicator, scheme)
+	replicator *plumberv1.Replicator,
+) (*metav1apply.OwnerReferenceApplyConfiguration, error) {
+	gvk, err := apiutil.GVKForObject(replicator, scheme)
 	if err != nil {
 		log.Error(err, "Unable get GVK")
-		return fmt.Errorf("unable to get GVK: %w", err)
+		return nil, fmt.Errorf("unable to get GVK: %w", err)
 	}
 
-	owner = metav1apply.OwnerReference().
+	owner := metav1apply.OwnerReference().
 		WithAPIVersion(gvk.GroupVersion().String()).
 		WithKind(gvk.Kind).
 		WithName(replicator.GetName()).
@@ -98,7 +234,67 @@ func createOwnerReferences(
 		WithBlockOwnerDeletion(true).
 		WithController(true)
 
-	return nil
+	return owner, nil
+}
+
+// Record an event on the Replicator.
+// A reconciler without a Recorder, e.g. in tests, records nothing.
+func (r *ReplicatorReconciler) eventf(
+	replicator *plumberv1.Replicator,
+	eventType, reason, messageFmt string,
+	args ...interface{},
+) {
+	if r.Recorder == nil {
+		return
+	}
+
+	r.Recorder.Eventf(replicator, eventType, reason, messageFmt, args...)
+}
+
+// Record an event on the Replicator that is being replicated.
+func (a ReplicateRuntime) eventf(eventType, reason, messageFmt string, args ...interface{}) {
+	if a.Recorder == nil {
+		return
+	}
+
+	a.Recorder.Eventf(&a.Replicator, eventType, reason, messageFmt, args...)
+}
+
+// Labels set on every replicated resource to record the owning Replicator.
+func replicatorLabels(replicator plumberv1.Replicator) map[string]string {
+	return map[string]string{constants.ReplicatorLabel: replicator.GetName()}
+}
+
+// Set the time of the last sync of the clusters that were applied,
+// and keep the previous one for the clusters that were not.
+func withLastSyncTime(prev, next []plumberv1.ClusterSyncStatus) []plumberv1.ClusterSyncStatus {
+	lastSyncTime := make(map[string]*metav1.Time)
+	for _, c := range prev {
+		lastSyncTime[c.Cluster] = c.LastSyncTime
+	}
+
+	now := metav1.Now()
+	for i := range next {
+		if next[i].State == plumberv1.ClusterSyncStateApplied {
+			next[i].LastSyncTime = &now
+		} else {
+			next[i].LastSyncTime = lastSyncTime[next[i].Cluster]
+		}
+	}
+
+	return next
+}
+
+// A suspended Replicator is not applied,
+// unless a sync has been requested with the sync-now annotation and not yet handled.
+func isSuspended(replicator plumberv1.Replicator) bool {
+	if !replicator.Spec.Suspend {
+		return false
+	}
+
+	syncNow, ok := replicator.GetAnnotations()[constants.SyncNowAnnotation]
+
+	return !ok || syncNow == replicator.Status.LastHandledSyncNow
 }
 
 func (r *ReplicatorReconciler) applyConfigMap(
@@ -113,10 +309,11 @@ func (r *ReplicatorReconciler) applyConfigMap(
 	nextConfigMapApplyConfig := corev1apply.ConfigMap(
 		applyRuntime.Replicator.Spec.ConfigMapName,
 		applyRuntime.Replicator.Spec.ReplicationNamespace).
+		WithLabels(replicatorLabels(applyRuntime.Replicator)).
 		WithData(applyRuntime.Replicator.Spec.ConfigMapData)
 
 	if applyRuntime.IsPrimary {
-		nextConfigMapApplyConfig.WithOwnerReferences(owner)
+		nextConfigMapApplyConfig.WithOwnerReferences(applyRuntime.Owner)
 	}
 
 	configMap, err := configMapClient.Get(
@@ -145,11 +342,33 @@ func (r *ReplicatorReconciler) applyConfigMap(
 		Name:        name,
 		ApplyStatus: applyStatus,
 	}
+	if applyRuntime.DryRun {
+		return previewApply(
+			applyRuntime,
+			fieldMgr,
+			s,
+			len(configMap.GetName()) > 0,
+			currConfigMapApplyConfig,
+			nextConfigMapApplyConfig,
+			func(opts metav1.ApplyOptions) (*corev1.ConfigMap, error) {
+				return configMapClient.Apply(applyRuntime.Context, nextConfigMapApplyConfig, opts)
+			},
+			func(applied *corev1.ConfigMap) (*corev1apply.ConfigMapApplyConfiguration, error) {
+				return corev1apply.ExtractConfigMap(applied, fieldMgr)
+			},
+		)
+	}
 	if equality.Semantic.DeepEqual(currConfigMapApplyConfig, nextConfigMapApplyConfig) {
-		syncStatus = append(syncStatus, s)
+		applyRuntime.SyncStatus.record(s)
+		return nil
+	}
+	if applyRuntime.Suspended {
+		s.ApplyStatus = applyStatusDrifted
+		applyRuntime.SyncStatus.record(s)
 		return nil
 	}
 
+	applyStart := time.Now()
 	applied, err := configMapClient.Apply(
 		applyRuntime.Context,
 		nextConfigMapApplyConfig,
@@ -158,16 +377,18 @@ func (r *ReplicatorReconciler) applyConfigMap(
 			Force:        true,
 		},
 	)
+	metrics.ObserveApply(applyRuntime.Cluster, kind, time.Since(applyStart), err)
 	if err != nil {
 		applyStatus = "not applied"
 		s.ApplyStatus = applyStatus
-		syncStatus = append(syncStatus, s)
+		s.Message = err.Error()
+		applyRuntime.SyncStatus.recordChange(s)
 
 		log.Error(err, "unable to apply")
 		return fmt.Errorf("failed to apply ConfigMap: %w", err)
 	}
 
-	syncStatus = append(syncStatus, s)
+	applyRuntime.SyncStatus.recordChange(s)
 
 	log.Info(fmt.Sprintf("Nginx ConfigMap Applied: [cluster] %s, [resource] %s", applyRuntime.Cluster, applied.GetName()))
 
@@ -187,6 +408,7 @@ func (r *ReplicatorReconciler) applyDeployment(
 	nextDeploymentApplyConfig := appsv1apply.Deployment(
 		applyRuntime.Replicator.Spec.DeploymentName,
 		applyRuntime.Replicator.Spec.ReplicationNamespace).
+		WithLabels(replicatorLabels(applyRuntime.Replicator)).
 		WithSpec(appsv1apply.DeploymentSpec().
 			WithSelector(metav1apply.LabelSelector().
 				WithMatchLabels(labels)))
@@ -210,7 +432,7 @@ func (r *ReplicatorReconciler) applyDeployment(
 	nextDeploymentApplyConfig.Spec.WithTemplate(podTemplate)
 
 	if applyRuntime.IsPrimary {
-		nextDeploymentApplyConfig.WithOwnerReferences(owner)
+		nextDeploymentApplyConfig.WithOwnerReferences(applyRuntime.Owner)
 	}
 
 	// If EmptyDir is not set to Medium or SizeLimit, applyconfiguration
@@ -255,11 +477,33 @@ func (r *ReplicatorReconciler) applyDeployment(
 		Name:        name,
 		ApplyStatus: applyStatus,
 	}
+	if applyRuntime.DryRun {
+		return previewApply(
+			applyRuntime,
+			fieldMgr,
+			s,
+			len(deployment.GetName()) > 0,
+			currDeploymentMapApplyConfig,
+			nextDeploymentApplyConfig,
+			func(opts metav1.ApplyOptions) (*appsv1.Deployment, error) {
+				return deploymentClient.Apply(applyRuntime.Context, nextDeploymentApplyConfig, opts)
+			},
+			func(applied *appsv1.Deployment) (*appsv1apply.DeploymentApplyConfiguration, error) {
+				return appsv1apply.ExtractDeployment(applied, fieldMgr)
+			},
+		)
+	}
 	if equality.Semantic.DeepEqual(currDeploymentMapApplyConfig, nextDeploymentApplyConfig) {
-		syncStatus = append(syncStatus, s)
+		applyRuntime.SyncStatus.record(s)
+		return nil
+	}
+	if applyRuntime.Suspended {
+		s.ApplyStatus = applyStatusDrifted
+		applyRuntime.SyncStatus.record(s)
 		return nil
 	}
 
+	applyStart := time.Now()
 	applied, err := deploymentClient.Apply(
 		applyRuntime.Context,
 		nextDeploymentApplyConfig,
@@ -268,16 +512,18 @@ func (r *ReplicatorReconciler) applyDeployment(
 			Force:        true,
 		},
 	)
+	metrics.ObserveApply(applyRuntime.Cluster, kind, time.Since(applyStart), err)
 	if err != nil {
 		applyStatus = "not applied"
 		s.ApplyStatus = applyStatus
-		syncStatus = append(syncStatus, s)
+		s.Message = err.Error()
+		applyRuntime.SyncStatus.recordChange(s)
 
 		log.Error(err, "unable to apply")
 		return fmt.Errorf("failed to apply Deployment: %w", err)
 	}
 
-	syncStatus = append(syncStatus, s)
+	applyRuntime.SyncStatus.recordChange(s)
 
 	log.Info(fmt.Sprintf("Nginx Deployment Applied: [cluster] %s, [resource] %s", applyRuntime.Cluster, applied.GetName()))
 
@@ -297,11 +543,12 @@ func (r *ReplicatorReconciler) applyService(
 	nextServiceApplyConfig := corev1apply.Service(
 		applyRuntime.Replicator.Spec.ServiceName,
 		applyRuntime.Replicator.Spec.ReplicationNamespace).
+		WithLabels(replicatorLabels(applyRuntime.Replicator)).
 		WithSpec((*corev1apply.ServiceSpecApplyConfiguration)(applyRuntime.Replicator.Spec.ServiceSpec).
 			WithSelector(labels))
 
 	if applyRuntime.IsPrimary {
-		nextServiceApplyConfig.WithOwnerReferences(owner)
+		nextServiceApplyConfig.WithOwnerReferences(applyRuntime.Owner)
 	}
 
 	service, err := serviceClient.Get(
@@ -330,11 +577,33 @@ func (r *ReplicatorReconciler) applyService(
 		Name:        name,
 		ApplyStatus: applyStatus,
 	}
+	if applyRuntime.DryRun {
+		return previewApply(
+			applyRuntime,
+			fieldMgr,
+			s,
+			len(service.GetName()) > 0,
+			currServiceApplyConfig,
+			nextServiceApplyConfig,
+			func(opts metav1.ApplyOptions) (*corev1.Service, error) {
+				return serviceClient.Apply(applyRuntime.Context, nextServiceApplyConfig, opts)
+			},
+			func(applied *corev1.Service) (*corev1apply.ServiceApplyConfiguration, error) {
+				return corev1apply.ExtractService(applied, fieldMgr)
+			},
+		)
+	}
 	if equality.Semantic.DeepEqual(currServiceApplyConfig, nextServiceApplyConfig) {
-		syncStatus = append(syncStatus, s)
+		applyRuntime.SyncStatus.record(s)
+		return nil
+	}
+	if applyRuntime.Suspended {
+		s.ApplyStatus = applyStatusDrifted
+		applyRuntime.SyncStatus.record(s)
 		return nil
 	}
 
+	applyStart := time.Now()
 	applied, err := serviceClient.Apply(
 		applyRuntime.Context,
 		nextServiceApplyConfig,
@@ -343,16 +612,18 @@ func (r *ReplicatorReconciler) applyService(
 			Force:        true,
 		},
 	)
+	metrics.ObserveApply(applyRuntime.Cluster, kind, time.Since(applyStart), err)
 	if err != nil {
 		applyStatus = "not applied"
 		s.ApplyStatus = applyStatus
-		syncStatus = append(syncStatus, s)
+		s.Message = err.Error()
+		applyRuntime.SyncStatus.recordChange(s)
 
 		log.Error(err, "unable to apply")
 		return fmt.Errorf("failed to apply Service: %w", err)
 	}
 
-	syncStatus = append(syncStatus, s)
+	applyRuntime.SyncStatus.recordChange(s)
 
 	log.Info(fmt.Sprintf("Nginx Service Applied: [cluster] %s, [resource] %s", applyRuntime.Cluster, applied.GetName()))
 
@@ -375,26 +646,53 @@ func (r *ReplicatorReconciler) applyIngress(
 	nextIngressApplyConfig := networkv1apply.Ingress(
 		applyRuntime.Replicator.Spec.IngressName,
 		applyRuntime.Replicator.Spec.ReplicationNamespace).
+		WithLabels(replicatorLabels(applyRuntime.Replicator)).
 		WithAnnotations(annotateRewriteTarget).
 		WithSpec((*networkv1apply.IngressSpecApplyConfiguration)(applyRuntime.Replicator.Spec.IngressSpec).
 			WithIngressClassName(constants.IngressClassName))
 
-	ingress, err := ingressClient.Get(
-		applyRuntime.Context,
-		applyRuntime.Replicator.Spec.IngressName,
-		metav1.GetOptions{},
+	// Clusters older than v1.19 only serve networking.k8s.io/v1beta1.
+	// The Ingress is built as v1 and converted before it is applied to them.
+	var (
+		ingress  = &networkv1.Ingress{}
+		tlsHosts []string
+		version  = applyRuntime.Versions.of(kindIngress)
 	)
-	if err != nil {
-		// If the resource does not exist, create it.
-		// Therefore, Not Found errors are ignored.
-		if !errors.IsNotFound(err) {
+	if version == networkingv1beta1.SchemeGroupVersion {
+		current, err := applyRuntime.ClientSet.NetworkingV1beta1().
+			Ingresses(applyRuntime.Replicator.Spec.ReplicationNamespace).
+			Get(applyRuntime.Context, applyRuntime.Replicator.Spec.IngressName, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
 			return fmt.Errorf("failed to get Ingress: %w", err)
 		}
+		if err == nil && len(current.Spec.TLS) > 0 {
+			tlsHosts = current.Spec.TLS[0].Hosts
+		}
+	} else {
+		current, err := ingressClient.Get(
+			applyRuntime.Context,
+			applyRuntime.Replicator.Spec.IngressName,
+			metav1.GetOptions{},
+		)
+		if err != nil {
+			// If the resource does not exist, create it.
+			// Therefore, Not Found errors are ignored.
+			if !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to get Ingress: %w", err)
+			}
+		}
+		if err == nil {
+			ingress = current
+		}
+		if len(ingress.Spec.TLS) > 0 {
+			tlsHosts = ingress.Spec.TLS[0].Hosts
+		}
 	}
 
-	if applyRuntime.Replicator.Spec.IngressSecureEnabled {
+	// The Secrets are neither re-created nor applied while the Replicator is suspended or previewed.
+	if applyRuntime.Replicator.Spec.IngressSecureEnabled && !applyRuntime.Suspended && !applyRuntime.DryRun {
 		// Re-create Secret if 'spec.tls[].hosts[]' has changed
-		if len(ingress.Spec.TLS) > 0 {
+		if len(tlsHosts) > 0 {
 			secrets, err := secretClient.List(
 				applyRuntime.Context,
 				metav1.ListOptions{},
@@ -403,7 +701,7 @@ func (r *ReplicatorReconciler) applyIngress(
 				return fmt.Errorf("failed to list Secret: %w", err)
 			}
 
-			ih := ingress.Spec.TLS[0].Hosts[0]
+			ih := tlsHosts[0]
 			sh := *applyRuntime.Replicator.Spec.IngressSpec.Rules[0].Host
 			if ih != sh {
 				log.Info("Host is not different")
@@ -435,7 +733,9 @@ func (r *ReplicatorReconciler) applyIngress(
 			log.Error(err, "Unable create Client Secret")
 			return fmt.Errorf("unable to create Client Secret: %w", err)
 		}
+	}
 
+	if applyRuntime.Replicator.Spec.IngressSecureEnabled {
 		nextIngressApplyConfig.
 			WithAnnotations(annotateVerifyClient).
 			WithAnnotations(annotateTlsSecret).
@@ -454,7 +754,11 @@ func (r *ReplicatorReconciler) applyIngress(
 	}
 
 	if applyRuntime.IsPrimary {
-		nextIngressApplyConfig.WithOwnerReferences(owner)
+		nextIngressApplyConfig.WithOwnerReferences(applyRuntime.Owner)
+	}
+
+	if version == networkingv1beta1.SchemeGroupVersion {
+		return r.applyIngressV1beta1(applyRuntime, fieldMgr, nextIngressApplyConfig)
 	}
 
 	currIngressApplyConfig, err := networkv1apply.ExtractIngress(ingress, fieldMgr)
@@ -471,11 +775,33 @@ func (r *ReplicatorReconciler) applyIngress(
 		Name:        name,
 		ApplyStatus: applyStatus,
 	}
+	if applyRuntime.DryRun {
+		return previewApply(
+			applyRuntime,
+			fieldMgr,
+			s,
+			len(ingress.GetName()) > 0,
+			currIngressApplyConfig,
+			nextIngressApplyConfig,
+			func(opts metav1.ApplyOptions) (*networkv1.Ingress, error) {
+				return ingressClient.Apply(applyRuntime.Context, nextIngressApplyConfig, opts)
+			},
+			func(applied *networkv1.Ingress) (*networkv1apply.IngressApplyConfiguration, error) {
+				return networkv1apply.ExtractIngress(applied, fieldMgr)
+			},
+		)
+	}
 	if equality.Semantic.DeepEqual(currIngressApplyConfig, nextIngressApplyConfig) {
-		syncStatus = append(syncStatus, s)
+		applyRuntime.SyncStatus.record(s)
+		return nil
+	}
+	if applyRuntime.Suspended {
+		s.ApplyStatus = applyStatusDrifted
+		applyRuntime.SyncStatus.record(s)
 		return nil
 	}
 
+	applyStart := time.Now()
 	applied, err := ingressClient.Apply(
 		applyRuntime.Context,
 		nextIngressApplyConfig,
@@ -484,16 +810,18 @@ func (r *ReplicatorReconciler) applyIngress(
 			Force:        true,
 		},
 	)
+	metrics.ObserveApply(applyRuntime.Cluster, kind, time.Since(applyStart), err)
 	if err != nil {
 		applyStatus = "not applied"
 		s.ApplyStatus = applyStatus
-		syncStatus = append(syncStatus, s)
+		s.Message = err.Error()
+		applyRuntime.SyncStatus.recordChange(s)
 
 		log.Error(err, "unable to apply")
 		return fmt.Errorf("failed to apply Ingress: %w", err)
 	}
 
-	syncStatus = append(syncStatus, s)
+	applyRuntime.SyncStatus.recordChange(s)
 
 	log.Info(fmt.Sprintf("Nginx Ingress Applied: [cluster] %s, [resource] %s", applyRuntime.Cluster, applied.GetName()))
 
@@ -547,10 +875,11 @@ func (r *ReplicatorReconciler) applyIngressSecret(
 	nextIngressSecretApplyConfig := corev1apply.Secret(
 		constants.IngressSecretName,
 		applyRuntime.Replicator.Spec.ReplicationNamespace).
+		WithLabels(replicatorLabels(applyRuntime.Replicator)).
 		WithData(secData)
 
 	if applyRuntime.IsPrimary {
-		nextIngressSecretApplyConfig.WithOwnerReferences(owner)
+		nextIngressSecretApplyConfig.WithOwnerReferences(applyRuntime.Owner)
 	}
 
 	kind := *nextIngressSecretApplyConfig.Kind
@@ -563,6 +892,7 @@ func (r *ReplicatorReconciler) applyIngressSecret(
 		ApplyStatus: applyStatus,
 	}
 
+	applyStart := time.Now()
 	applied, err := secretClient.Apply(
 		applyRuntime.Context,
 		nextIngressSecretApplyConfig,
@@ -571,18 +901,27 @@ func (r *ReplicatorReconciler) applyIngressSecret(
 			Force:        true,
 		},
 	)
+	metrics.ObserveApply(applyRuntime.Cluster, kind, time.Since(applyStart), err)
 	if err != nil {
 		applyStatus = "not applied"
 		s.ApplyStatus = applyStatus
-		syncStatus = append(syncStatus, s)
+		s.Message = err.Error()
+		applyRuntime.SyncStatus.record(s)
 
 		log.Error(err, "unable to apply")
 		return fmt.Errorf("failed to apply Secret: %w", err)
 	}
 
-	syncStatus = append(syncStatus, s)
+	applyRuntime.SyncStatus.record(s)
 
 	log.Info(fmt.Sprintf("Nginx Server Certificates Secret Applied: [cluster] %s, [resource] %s", applyRuntime.Cluster, applied.GetName()))
+	applyRuntime.eventf(
+		corev1.EventTypeNormal,
+		"CertificateIssued",
+		"Issued CA and server certificates in Secret %s on cluster %s",
+		applied.GetName(),
+		applyRuntime.Cluster,
+	)
 
 	return nil
 }
@@ -627,12 +966,14 @@ func (r *ReplicatorReconciler) applyClientSecret(
 	nextClientSecretApplyConfig := corev1apply.Secret(
 		constants.ClientSecretName,
 		applyRuntime.Replicator.Spec.ReplicationNamespace).
+		WithLabels(replicatorLabels(applyRuntime.Replicator)).
 		WithData(secData)
 
 	if applyRuntime.IsPrimary {
-		nextClientSecretApplyConfig.WithOwnerReferences(owner)
+		nextClientSecretApplyConfig.WithOwnerReferences(applyRuntime.Owner)
 	}
 
+	applyStart := time.Now()
 	applied, err := secretClient.Apply(
 		applyRuntime.Context,
 		nextClientSecretApplyConfig,
@@ -641,12 +982,20 @@ func (r *ReplicatorReconciler) applyClientSecret(
 			Force:        true,
 		},
 	)
+	metrics.ObserveApply(applyRuntime.Cluster, *nextClientSecretApplyConfig.Kind, time.Since(applyStart), err)
 	if err != nil {
 		log.Error(err, "unable to apply")
 		return fmt.Errorf("failed to apply Secret: %w", err)
 	}
 
 	log.Info(fmt.Sprintf("Nginx Client Certificates Secret Applied: [cluster] %s, [resource] %s", applyRuntime.Cluster, applied.GetName()))
+	applyRuntime.eventf(
+		corev1.EventTypeNormal,
+		"CertificateIssued",
+		"Issued client certificates in Secret %s on cluster %s",
+		applied.GetName(),
+		applyRuntime.Cluster,
+	)
 
 	return nil
 }
@@ -654,246 +1003,963 @@ func (r *ReplicatorReconciler) applyClientSecret(
 func (r *ReplicatorReconciler) applyResources(
 	applyFuncArgs ReplicateRuntime,
 ) error {
-	var applyErr error
+	var (
+		applyErr error
+		spec     = applyFuncArgs.Replicator.Spec
+	)
 
-	if applyFuncArgs.Replicator.Spec.ConfigMapData != nil {
-		// Create Configmap
-		// Generate default.conf and index.html
-		if err := r.applyConfigMap(
-			applyFuncArgs,
-			constants.FieldManager,
-		); err != nil {
+	// Each resource is applied in its own span.
+	apply := func(kind, name string, applyFunc func(ReplicateRuntime, string) error) {
+		ctx, span := tracing.Start(
+			applyFuncArgs.Context,
+			"Apply"+kind,
+			tracing.ClusterKey.String(applyFuncArgs.Cluster),
+			tracing.NamespaceKey.String(spec.ReplicationNamespace),
+			tracing.KindKey.String(kind),
+			tracing.NameKey.String(name),
+		)
+		applyRuntime := applyFuncArgs
+		applyRuntime.Context = ctx
+
+		err := applyFunc(applyRuntime, constants.FieldManager)
+		tracing.End(span, err)
+		if err != nil {
 			applyErr = multierr.Append(applyErr, err)
 		}
 	}
 
+	if spec.ConfigMapData != nil {
+		// Create Configmap
+		// Generate default.conf and index.html
+		apply("ConfigMap", spec.ConfigMapName, r.applyConfigMap)
+	}
+
 	// Create Deployment
 	// Deployment resources are required.
-	if err := r.applyDeployment(
-		applyFuncArgs,
-		constants.FieldManager,
-	); err != nil {
-		applyErr = multierr.Append(applyErr, err)
-	}
+	apply("Deployment", spec.DeploymentName, r.applyDeployment)
 
 	// Create Service
-	if applyFuncArgs.Replicator.Spec.ServiceSpec != nil {
-		if err := r.applyService(
-			applyFuncArgs,
-			constants.FieldManager,
-		); err != nil {
-			applyErr = multierr.Append(applyErr, err)
-		}
+	if spec.ServiceSpec != nil {
+		apply("Service", spec.ServiceName, r.applyService)
 	}
 
 	// Create Ingress
-	if applyFuncArgs.Replicator.Spec.IngressSpec != nil {
-		if err := r.applyIngress(
-			applyFuncArgs,
-			constants.FieldManager,
-		); err != nil {
-			applyErr = multierr.Append(applyErr, err)
-		}
+	if spec.IngressSpec != nil {
+		apply("Ingress", spec.IngressName, r.applyIngress)
 	}
 
 	return applyErr
 }
 
+// Outcome of a Replicate call.
+type ReplicateResult struct {
+	// Apply result of each resource, sorted by cluster.
+	Applied []plumberv1.PerResourceApplyStatus
+
+	// Result of each cluster, sorted by cluster.
+	Clusters []plumberv1.ClusterSyncStatus
+
+	// Time until the next probe of the skipped clusters is allowed.
+	// Zero if no cluster was skipped.
+	RetryAfter time.Duration
+
+	// Result of each resource when previewed, sorted by cluster.
+	DryRun []plumberv1.DryRunResult
+
+	// Apply result of each resource that was changed, sorted by cluster.
+	Changes []plumberv1.PerResourceApplyStatus
+}
+
+// Create the replication namespace and apply the resources to a single cluster.
+// The time taken is recorded in the returned ClusterSyncStatus.
+func (r *ReplicatorReconciler) replicateToCluster(applyRuntime ReplicateRuntime) (plumberv1.ClusterSyncStatus, error) {
+	start := time.Now()
+
+	var span trace.Span
+	applyRuntime.Context, span = tracing.Start(
+		applyRuntime.Context,
+		"ReplicateToCluster",
+		tracing.ClusterKey.String(applyRuntime.Cluster),
+		tracing.NamespaceKey.String(applyRuntime.Replicator.Spec.ReplicationNamespace),
+		attribute.Bool("plumber.primary", applyRuntime.IsPrimary),
+	)
+
+	// The namespace is not created while the Replicator is suspended or previewed.
+	if applyRuntime.DryRun {
+		previewNamespace(applyRuntime)
+	} else if !applyRuntime.Suspended {
+		created, err := createNamespace(
+			applyRuntime.Context,
+			applyRuntime.Log,
+			applyRuntime.Replicator,
+			applyRuntime.Cluster,
+			applyRuntime.ClientSet,
+		)
+		if err != nil {
+			applyRuntime.Log.Error(err, fmt.Sprintf("Unable to create namespace for cluster %s.", applyRuntime.Cluster))
+		}
+		if created {
+			applyRuntime.eventf(
+				corev1.EventTypeNormal,
+				"NamespaceCreated",
+				"Created namespace %s on cluster %s",
+				applyRuntime.Replicator.Spec.ReplicationNamespace,
+				applyRuntime.Cluster,
+			)
+		}
+	}
+
+	err := r.applyResources(applyRuntime)
+
+	for _, changed := range applyRuntime.SyncStatus.changesOf(applyRuntime.Cluster) {
+		if changed.ApplyStatus == "applied" {
+			applyRuntime.eventf(
+				corev1.EventTypeNormal,
+				"Applied",
+				"Applied %s %s to cluster %s",
+				changed.Kind,
+				changed.Name,
+				applyRuntime.Cluster,
+			)
+			continue
+		}
+		applyRuntime.eventf(
+			corev1.EventTypeWarning,
+			"ApplyFailed",
+			"Failed to apply %s %s to cluster %s",
+			changed.Kind,
+			changed.Name,
+			applyRuntime.Cluster,
+		)
+	}
+
+	status := plumberv1.ClusterSyncStatus{
+		Cluster:  applyRuntime.Cluster,
+		State:    plumberv1.ClusterSyncStateApplied,
+		Duration: metav1.Duration{Duration: time.Since(start)},
+	}
+	switch {
+	case err != nil:
+		status.State = plumberv1.ClusterSyncStateFailed
+		status.Message = err.Error()
+		applyRuntime.eventf(
+			corev1.EventTypeWarning,
+			"ReplicationFailed",
+			"Replication to cluster %s failed: %s",
+			applyRuntime.Cluster,
+			err,
+		)
+	case applyRuntime.Suspended && applyRuntime.SyncStatus.drifted(applyRuntime.Cluster):
+		status.State = plumberv1.ClusterSyncStateDrifted
+		status.Message = "resources differ from the Replicator"
+	}
+
+	// Nothing is read back after a preview, since nothing was applied.
+	if err == nil && !applyRuntime.DryRun {
+		status.Workload = workloadHealth(
+			applyRuntime.Context,
+			applyRuntime.Replicator,
+			applyRuntime.ClientSet,
+			applyRuntime.Versions,
+		)
+	}
+
+	applyRuntime.Log.Info(fmt.Sprintf("Replication finished: [cluster] %s, [state] %s, [duration] %s",
+		status.Cluster, status.State, status.Duration.Duration))
+	span.SetAttributes(attribute.String("plumber.state", status.State))
+	tracing.End(span, err)
+
+	return status, err
+}
+
+// Return a context bounded by ClusterTimeout for the requests to a single secondary cluster,
+// so that a cluster that does not answer cannot block the others.
+func (r *ReplicatorReconciler) clusterContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.ClusterTimeout > 0 {
+		return context.WithTimeout(ctx, r.ClusterTimeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// Apply the resources to the primary cluster and then replicate them to the secondary clusters.
+// The secondary clusters are processed concurrently, at most MaxConcurrentClusters at a time,
+// and each of them is given ClusterTimeout to complete.
+// Secondary clusters whose circuit is open are skipped and do not count as a failure.
+// The apply result of each resource is returned even if the replication failed.
 func (r *ReplicatorReconciler) Replicate(
 	ctx context.Context,
 	log logr.Logger,
 	req ctrl.Request,
-	primaryClientSet map[string]*kubernetes.Clientset,
-	secondaryClientsets map[string]*kubernetes.Clientset,
-) error {
+	replicator plumberv1.Replicator,
+	primaryClientSet map[string]kubernetes.Interface,
+	secondaryClientsets map[string]kubernetes.Interface,
+) (ReplicateResult, error) {
+	return r.replicate(ctx, log, req, replicator, primaryClientSet, secondaryClientsets, false)
+}
+
+func (r *ReplicatorReconciler) replicate(
+	ctx context.Context,
+	log logr.Logger,
+	req ctrl.Request,
+	replicator plumberv1.Replicator,
+	primaryClientSet map[string]kubernetes.Interface,
+	secondaryClientsets map[string]kubernetes.Interface,
+	dryRun bool,
+) (ReplicateResult, error) {
+	ctx, span := tracing.Start(
+		ctx,
+		"Replicate",
+		tracing.KindKey.String("Replicator"),
+		tracing.NameKey.String(replicator.GetName()),
+		tracing.NamespaceKey.String(replicator.Spec.ReplicationNamespace),
+		attribute.Bool("plumber.dry_run", dryRun),
+	)
+	result, err := r.replicateClusters(ctx, log, req, replicator, primaryClientSet, secondaryClientsets, dryRun)
+	tracing.End(span, err)
+
+	return result, err
+}
+
+func (r *ReplicatorReconciler) replicateClusters(
+	ctx context.Context,
+	log logr.Logger,
+	req ctrl.Request,
+	replicator plumberv1.Replicator,
+	primaryClientSet map[string]kubernetes.Interface,
+	secondaryClientsets map[string]kubernetes.Interface,
+	dryRun bool,
+) (ReplicateResult, error) {
 	var (
-		applyFailed      bool
-		err              error
-		replicateRuntime ReplicateRuntime
+		applyFailed bool
+		mu          sync.Mutex
+		result      ReplicateResult
+		status      = &syncStatus{}
+		wg          sync.WaitGroup
 	)
 
-	replicateRuntime = ReplicateRuntime{
-		Context:    ctx,
-		Log:        log,
-		Replicator: replicator,
-		Request:    req,
+	owner, err := createOwnerReferences(log, r.Scheme, &replicator)
+	if err != nil {
+		return result, err
+	}
+
+	suspended := isSuspended(replicator)
+	required := requiredCapabilities(replicator)
+
+	// Each cluster gets its own copy of the Replicator,
+	// since the apply functions modify the specs while building the apply configurations.
+	newRuntime := func(cluster string, clientSet kubernetes.Interface, isPrimary bool) ReplicateRuntime {
+		return ReplicateRuntime{
+			ClientSet:  clientSet,
+			IsPrimary:  isPrimary,
+			Context:    ctx,
+			Log:        log,
+			Cluster:    cluster,
+			Owner:      owner,
+			Replicator: *replicator.DeepCopy(),
+			Recorder:   r.Recorder,
+			Request:    req,
+			SyncStatus: status,
+			Suspended:  suspended,
+			DryRun:     dryRun,
+		}
+	}
+
+	finish := func() ReplicateResult {
+		result.Applied = status.sorted()
+		result.DryRun = status.sortedDryRun()
+		result.Changes = status.sortedChanges()
+		sort.Slice(result.Clusters, func(i, j int) bool {
+			return result.Clusters[i].Cluster < result.Clusters[j].Cluster
+		})
+		return result
 	}
 
 	for primaryClusterName, clientSet := range primaryClientSet {
-		replicateRuntime.ClientSet = clientSet
-		replicateRuntime.IsPrimary = true
-		replicateRuntime.Cluster = primaryClusterName
-		if err := r.applyResources(replicateRuntime); err != nil {
-			return fmt.Errorf("failed to apply resources: %w", err)
+		clusterStatus, err := r.replicateToCluster(newRuntime(primaryClusterName, clientSet, true))
+		result.Clusters = append(result.Clusters, clusterStatus)
+		// A preview continues with the secondary clusters, so that all rejections are reported at once.
+		if err != nil && !dryRun {
+			return finish(), fmt.Errorf("failed to apply resources: %w", err)
+		}
+		if err != nil {
+			applyFailed = true
 		}
 	}
 
 	// After successful resource deployment to the local cluster,
 	// replicate the resources to the remote cluster.
+	workers := r.MaxConcurrentClusters
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
 	for secondaryClusterName, clientSet := range secondaryClientsets {
-		replicateRuntime.ClientSet = clientSet
-		replicateRuntime.IsPrimary = false
-		replicateRuntime.Cluster = secondaryClusterName
-		if err = r.applyResources(replicateRuntime); err != nil {
-			applyFailed = true
-			log.Error(err, fmt.Sprintf("Could not replicate to Secondary Cluster %s", secondaryClusterName))
-		}
+		wg.Add(1)
+		go func(cluster string, clientSet kubernetes.Interface) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// A preview neither consults nor affects the circuit breaker.
+			breaker := r.Breaker
+			if dryRun {
+				breaker = nil
+			}
+
+			if ok, wait := breaker.Allow(cluster); !ok {
+				mu.Lock()
+				defer mu.Unlock()
+				result.Clusters = append(result.Clusters, plumberv1.ClusterSyncStatus{
+					Cluster: cluster,
+					State:   plumberv1.ClusterSyncStateSkipped,
+					Message: "circuit open",
+				})
+				if result.RetryAfter == 0 || wait < result.RetryAfter {
+					result.RetryAfter = wait
+				}
+				return
+			}
+
+			applyRuntime := newRuntime(cluster, clientSet, false)
+			var cancel context.CancelFunc
+			applyRuntime.Context, cancel = r.clusterContext(ctx)
+			defer cancel()
+
+			// Applying to a cluster that lacks a capability of the Replicator would fail on every reconcile,
+			// so the cluster is skipped until the capability is installed.
+			skipIncompatible := func(reason, message string) {
+				if !dryRun {
+					applyRuntime.eventf(corev1.EventTypeWarning, reason, "Skipped target cluster %s, %s", cluster, message)
+				}
+				// The cluster answered, so it does not count against its circuit.
+				if breaker.Success(cluster) {
+					log.Info(fmt.Sprintf("Circuit closed: [cluster] %s", cluster))
+				}
+				r.markIncompatible(replicator, cluster)
+
+				mu.Lock()
+				defer mu.Unlock()
+				result.Clusters = append(result.Clusters, plumberv1.ClusterSyncStatus{
+					Cluster: cluster,
+					State:   plumberv1.ClusterSyncStateSkipped,
+					Message: message,
+				})
+				if result.RetryAfter == 0 || capabilityRecheckInterval < result.RetryAfter {
+					result.RetryAfter = capabilityRecheckInterval
+				}
+			}
+
+			r.recheckCapabilities(replicator, cluster)
+
+			// Kinds served in an older version by the cluster are converted before they are applied.
+			var err error
+			applyRuntime.Versions, err = negotiateVersions(applyRuntime.Context, clientSet, negotiatedKinds(replicator))
+			if unsupported, ok := err.(*unsupportedVersionError); ok {
+				skipIncompatible("UnsupportedVersion", unsupported.Error())
+				return
+			}
+			if err != nil {
+				log.Error(err, fmt.Sprintf("Could not negotiate API versions with Secondary Cluster %s", cluster))
+			}
+
+			missing, err := missingCapabilities(applyRuntime.Context, clientSet, required, applyRuntime.Versions)
+			if err != nil {
+				log.Error(err, fmt.Sprintf("Could not check capabilities of Secondary Cluster %s", cluster))
+			}
+			if len(missing) > 0 {
+				skipIncompatible("IncompatibleCluster", incompatibleMessage(missing))
+				return
+			}
+			r.forgetIncompatible(replicator, cluster)
+
+			clusterStatus, err := r.replicateToCluster(applyRuntime)
+			if err != nil {
+				// The cluster may come back upgraded, so its clients and discovery results are rebuilt.
+				if breaker.Failure(cluster) {
+					log.Info(fmt.Sprintf("Circuit opened: [cluster] %s", cluster))
+					r.Clientsets.Invalidate(cluster)
+				}
+			} else if breaker.Success(cluster) {
+				log.Info(fmt.Sprintf("Circuit closed: [cluster] %s", cluster))
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Clusters = append(result.Clusters, clusterStatus)
+			if err != nil {
+				applyFailed = true
+				log.Error(err, fmt.Sprintf("Could not replicate to Secondary Cluster %s", cluster))
+			}
+		}(secondaryClusterName, clientSet)
 	}
+	wg.Wait()
+
 	// If one of the clusters fails to replicate, it is considered a synchronization failure.
 	if applyFailed {
-		return fmt.Errorf("Could not sync on all clusters")
+		return finish(), fmt.Errorf("Could not sync on all clusters")
 	}
 
-	return nil
+	return finish(), nil
 }
 
 func createNamespace(
 	ctx context.Context,
 	log logr.Logger,
 	replicator plumberv1.Replicator,
-	secondaryClientsets map[string]*kubernetes.Clientset,
-) error {
-	for cluster, clientSet := range secondaryClientsets {
-		var namespaceClient = clientSet.CoreV1().Namespaces()
+	cluster string,
+	clientSet kubernetes.Interface,
+) (bool, error) {
+	var namespaceClient = clientSet.CoreV1().Namespaces()
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   replicator.Spec.ReplicationNamespace,
+			Labels: replicatorLabels(replicator),
+		},
+	}
 
-		ns := &corev1.Namespace{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: replicator.Spec.ReplicationNamespace,
-			},
+	if _, err := namespaceClient.Get(
+		ctx,
+		replicator.Spec.ReplicationNamespace,
+		metav1.GetOptions{},
+	); err != nil {
+		// If the resource does not exist, create it.
+		// Therefore, Not Found errors are ignored.
+		if !errors.IsNotFound(err) {
+			return false, fmt.Errorf("Could not get namespace %w", err)
 		}
 
-		if _, err := namespaceClient.Get(
-			ctx,
-			replicator.Spec.ReplicationNamespace,
-			metav1.GetOptions{},
-		); err != nil {
-			// If the resource does not exist, create it.
-			// Therefore, Not Found errors are ignored.
-			if !errors.IsNotFound(err) {
-				return fmt.Errorf("Could not get namespace %w", err)
-			}
+		created, err := namespaceClient.Create(ctx, ns, metav1.CreateOptions{})
+		if err != nil {
+			return false, fmt.Errorf("Could not create namespace %w", err)
+		}
 
-			created, err := namespaceClient.Create(ctx, ns, metav1.CreateOptions{})
-			if err != nil {
-				return fmt.Errorf("Could not create namespace %w", err)
-			}
+		log.Info(fmt.Sprintf("Namespace creation: [cluster] %s, [resource] %s", cluster, created.GetName()))
 
-			log.Info(fmt.Sprintf("Namespace creation: [cluster] %s, [resource] %s", cluster, created.GetName()))
-		}
+		return true, nil
 	}
-	return nil
+
+	return false, nil
 }
 
-func deletePrimaryNamespace(
-	ctx context.Context,
-	log logr.Logger,
-	primaryClientSet map[string]*kubernetes.Clientset,
-	primaryNamespaceName string,
-) error {
-	for _, clientSet := range primaryClientSet {
-		var namespaceClient = clientSet.CoreV1().Namespaces()
-		if err := namespaceClient.Delete(
-			ctx,
-			primaryNamespaceName,
-			metav1.DeleteOptions{},
-		); err != nil {
-			log.Error(err, "unable to delete primary namespace")
+// Returns the DeletionPolicy that applies to the given cluster.
+// A per-cluster override takes precedence over .spec.deletionPolicy.
+func deletionPolicyFor(replicator plumberv1.Replicator, cluster string) plumberv1.DeletionPolicy {
+	for _, p := range replicator.Spec.ClusterDeletionPolicies {
+		if p.Cluster == cluster {
+			return p.Policy
 		}
 	}
 
-	return nil
+	if replicator.Spec.DeletionPolicy == "" {
+		return plumberv1.DeletionPolicyDelete
+	}
+
+	return replicator.Spec.DeletionPolicy
 }
 
-func deleteSecondaryClusterResources(
+// Typed clients such as ConfigMapInterface or DeploymentInterface satisfy this interface.
+type releasableClient[T metav1.Object] interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (T, error)
+	Update(ctx context.Context, obj T, opts metav1.UpdateOptions) (T, error)
+}
+
+// Remove the owner reference to the Replicator and, if stripLabels is set,
+// the plumber label from a single resource. Missing resources are ignored.
+func releaseResource[T metav1.Object](
+	ctx context.Context,
+	c releasableClient[T],
+	name string,
+	owner types.UID,
+	stripLabels bool,
+) error {
+	obj, err := c.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	var (
+		changed bool
+		refs    []metav1.OwnerReference
+	)
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == owner {
+			changed = true
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	obj.SetOwnerReferences(refs)
+
+	if stripLabels {
+		labels := obj.GetLabels()
+		if _, ok := labels[constants.ReplicatorLabel]; ok {
+			delete(labels, constants.ReplicatorLabel)
+			obj.SetLabels(labels)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if _, err := c.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Detach the replicated resources of one cluster from the Replicator so that
+// they keep running after the Replicator is deleted.
+// The plumber labels are only stripped for the Orphan policy.
+func releaseClusterResources(
 	ctx context.Context,
 	log logr.Logger,
 	replicator plumberv1.Replicator,
-	secondaryClientsets map[string]*kubernetes.Clientset,
+	cluster string,
+	clientSet kubernetes.Interface,
+	policy plumberv1.DeletionPolicy,
 ) error {
-	var deleteErr error
-	for cluster, clientSet := range secondaryClientsets {
-		var (
-			configMapClient  = clientSet.CoreV1().ConfigMaps(replicator.Spec.ReplicationNamespace)
-			deploymentClient = clientSet.AppsV1().Deployments(replicator.Spec.ReplicationNamespace)
-			serviceClient    = clientSet.CoreV1().Services(replicator.Spec.ReplicationNamespace)
-			ingressClient    = clientSet.NetworkingV1().Ingresses(replicator.Spec.ReplicationNamespace)
-			secretClient     = clientSet.CoreV1().Secrets(replicator.Spec.ReplicationNamespace)
-			namespaceClient  = clientSet.CoreV1().Namespaces()
-		)
-
-		if replicator.Spec.IngressSecureEnabled {
-			if err := secretClient.Delete(
-				ctx,
-				constants.ClientSecretName,
-				metav1.DeleteOptions{},
-			); err != nil {
-				log.Error(err, fmt.Sprintf("Unable to delete client secret for secondary cluster %s.", cluster))
-				deleteErr = multierr.Append(deleteErr, err)
-			}
+	var (
+		releaseErr  error
+		namespace   = replicator.Spec.ReplicationNamespace
+		owner       = replicator.GetUID()
+		stripLabels = policy == plumberv1.DeletionPolicyOrphan
+	)
 
-			if err := secretClient.Delete(
+	if replicator.Spec.IngressSecureEnabled {
+		for _, name := range []string{constants.ClientSecretName, constants.IngressSecretName} {
+			if err := releaseResource[*corev1.Secret](
 				ctx,
-				constants.IngressSecretName,
-				metav1.DeleteOptions{},
+				clientSet.CoreV1().Secrets(namespace),
+				name,
+				owner,
+				stripLabels,
 			); err != nil {
-				log.Error(err, fmt.Sprintf("Unable to delete server secret for secondary cluster %s.", cluster))
-				deleteErr = multierr.Append(deleteErr, err)
+				releaseErr = multierr.Append(releaseErr, fmt.Errorf("failed to release Secret %s: %w", name, err))
 			}
 		}
+	}
 
-		if replicator.Spec.IngressSpec != nil {
-			if err := ingressClient.Delete(
+	if replicator.Spec.IngressSpec != nil {
+		versions, err := versionsFor(ctx, clientSet, replicator)
+		switch _, unsupported := err.(*unsupportedVersionError); {
+		case unsupported:
+			// The cluster serves no Ingress API, so it has no Ingress to release.
+			err = nil
+		case err != nil:
+		case versions.of(kindIngress) == networkingv1beta1.SchemeGroupVersion:
+			err = releaseResource[*networkingv1beta1.Ingress](
 				ctx,
+				clientSet.NetworkingV1beta1().Ingresses(namespace),
 				replicator.Spec.IngressName,
-				metav1.DeleteOptions{},
-			); err != nil {
-				log.Error(err, fmt.Sprintf("Unable to delete ingress for secondary cluster %s.", cluster))
-				deleteErr = multierr.Append(deleteErr, err)
+				owner,
+				stripLabels,
+			)
+		default:
+			err = releaseResource[*networkv1.Ingress](
+				ctx,
+				clientSet.NetworkingV1().Ingresses(namespace),
+				replicator.Spec.IngressName,
+				owner,
+				stripLabels,
+			)
+		}
+		if err != nil {
+			releaseErr = multierr.Append(releaseErr, fmt.Errorf("failed to release Ingress: %w", err))
+		}
+	}
+
+	if replicator.Spec.ServiceSpec != nil {
+		if err := releaseResource[*corev1.Service](
+			ctx,
+			clientSet.CoreV1().Services(namespace),
+			replicator.Spec.ServiceName,
+			owner,
+			stripLabels,
+		); err != nil {
+			releaseErr = multierr.Append(releaseErr, fmt.Errorf("failed to release Service: %w", err))
+		}
+	}
+
+	// Required Resources
+	if err := releaseResource[*appsv1.Deployment](
+		ctx,
+		clientSet.AppsV1().Deployments(namespace),
+		replicator.Spec.DeploymentName,
+		owner,
+		stripLabels,
+	); err != nil {
+		releaseErr = multierr.Append(releaseErr, fmt.Errorf("failed to release Deployment: %w", err))
+	}
+
+	if replicator.Spec.ConfigMapData != nil {
+		if err := releaseResource[*corev1.ConfigMap](
+			ctx,
+			clientSet.CoreV1().ConfigMaps(namespace),
+			replicator.Spec.ConfigMapName,
+			owner,
+			stripLabels,
+		); err != nil {
+			releaseErr = multierr.Append(releaseErr, fmt.Errorf("failed to release ConfigMap: %w", err))
+		}
+	}
+
+	if err := releaseResource[*corev1.Namespace](
+		ctx,
+		clientSet.CoreV1().Namespaces(),
+		namespace,
+		owner,
+		stripLabels,
+	); err != nil {
+		releaseErr = multierr.Append(releaseErr, fmt.Errorf("failed to release Namespace: %w", err))
+	}
+
+	if releaseErr == nil {
+		log.Info(fmt.Sprintf("Resources released with %s policy: [cluster] %s", policy, cluster))
+	}
+
+	return releaseErr
+}
+
+// The resources of the primary cluster are deleted by the garbage collector through their owner references.
+// For clusters that do not use the Delete policy, the owner references must be removed
+// before the finalizer is removed.
+func releasePrimaryClusterResources(
+	ctx context.Context,
+	log logr.Logger,
+	replicator plumberv1.Replicator,
+	primaryClientSet map[string]kubernetes.Interface,
+) error {
+	var releaseErr error
+	for cluster, clientSet := range primaryClientSet {
+		policy := deletionPolicyFor(replicator, cluster)
+		if policy == plumberv1.DeletionPolicyDelete {
+			continue
+		}
+
+		if err := releaseClusterResources(ctx, log, replicator, cluster, clientSet, policy); err != nil {
+			log.Error(err, fmt.Sprintf("Unable to release resources for primary cluster %s.", cluster))
+			releaseErr = multierr.Append(releaseErr, err)
+		}
+	}
+
+	return releaseErr
+}
+
+func deletePrimaryNamespace(
+	ctx context.Context,
+	log logr.Logger,
+	replicator plumberv1.Replicator,
+	primaryClientSet map[string]kubernetes.Interface,
+) error {
+	for cluster, clientSet := range primaryClientSet {
+		if deletionPolicyFor(replicator, cluster) != plumberv1.DeletionPolicyDelete {
+			continue
+		}
+
+		var namespaceClient = clientSet.CoreV1().Namespaces()
+		if err := namespaceClient.Delete(
+			ctx,
+			replicator.Spec.ReplicationNamespace,
+			metav1.DeleteOptions{},
+		); err != nil {
+			log.Error(err, "unable to delete primary namespace")
+		}
+	}
+
+	return nil
+}
+
+// Finalize the resources of one secondary cluster according to its DeletionPolicy.
+func finalizeSecondaryCluster(
+	ctx context.Context,
+	log logr.Logger,
+	replicator plumberv1.Replicator,
+	cluster string,
+	clientSet kubernetes.Interface,
+) error {
+	switch policy := deletionPolicyFor(replicator, cluster); policy {
+	case plumberv1.DeletionPolicyOrphan:
+		return releaseClusterResources(ctx, log, replicator, cluster, clientSet, policy)
+	case plumberv1.DeletionPolicyRetain:
+		// Resources in the secondary clusters have no owner references,
+		// so there is nothing to do.
+		log.Info(fmt.Sprintf("Resources retained: [cluster] %s", cluster))
+		return nil
+	default:
+		return deleteClusterResources(ctx, log, replicator, cluster, clientSet)
+	}
+}
+
+// Wait time before the next cleanup attempt of a cluster.
+// It doubles with every failed attempt up to cleanupMaxBackoff.
+func cleanupBackoff(attempts int32) time.Duration {
+	backoff := cleanupBaseBackoff
+	for i := int32(1); i < attempts; i++ {
+		backoff *= 2
+		if backoff >= cleanupMaxBackoff {
+			return cleanupMaxBackoff
+		}
+	}
+
+	return backoff
+}
+
+// Run one step of the deletion state machine.
+// Each secondary cluster is cleaned up independently and retried with backoff
+// while it is recorded in .status.pendingCleanups.
+// The finalizer is removed when every cluster has been cleaned up,
+// when .spec.cleanupTimeout expires or when the force-delete annotation is set.
+func (r *ReplicatorReconciler) finalize(
+	ctx context.Context,
+	log logr.Logger,
+	replicator *plumberv1.Replicator,
+	primaryClientsets map[string]kubernetes.Interface,
+	secondaryClientsets map[string]kubernetes.Interface,
+	primaryTargets map[string]bool,
+	clientsetErr error,
+) (ctrl.Result, error) {
+	// Owner references must be removed before the finalizer is removed,
+	// otherwise the garbage collector deletes the resources to be kept.
+	if err := releasePrimaryClusterResources(ctx, log, *replicator, primaryClientsets); err != nil {
+		log.Error(err, "Unable to release primary cluster resources")
+		return ctrl.Result{}, err
+	}
+
+	if replicator.GetAnnotations()[constants.ForceDeleteAnnotation] == "true" {
+		r.eventf(
+			replicator,
+			corev1.EventTypeWarning,
+			"ForceDeleted",
+			"Cleanup of secondary clusters skipped by force-delete annotation",
+		)
+		return ctrl.Result{}, r.removeFinalizer(ctx, replicator)
+	}
+
+	// On the first pass, every target cluster is pending.
+	// The primary cluster is never replicated to as a secondary cluster, so it has nothing to clean up.
+	if replicator.Status.PendingCleanups == nil {
+		for _, cluster := range replicator.Spec.TargetCluster {
+			if _, ok := primaryClientsets[cluster]; ok || primaryTargets[cluster] {
+				continue
 			}
+			replicator.Status.PendingCleanups = append(
+				replicator.Status.PendingCleanups,
+				plumberv1.PendingCleanup{Cluster: cluster},
+			)
 		}
+	}
 
-		if replicator.Spec.ServiceSpec != nil {
-			if err := serviceClient.Delete(
-				ctx,
-				replicator.Spec.ServiceName,
-				metav1.DeleteOptions{},
-			); err != nil {
-				log.Error(err, fmt.Sprintf("Unable to delete service for secondary cluster %s.", cluster))
-				deleteErr = multierr.Append(deleteErr, err)
+	var (
+		now          = time.Now()
+		pending      []plumberv1.PendingCleanup
+		requeueAfter time.Duration
+	)
+	for _, p := range replicator.Status.PendingCleanups {
+		if p.LastAttemptTime != nil {
+			if wait := p.LastAttemptTime.Add(cleanupBackoff(p.Attempts)).Sub(now); wait > 0 {
+				pending = append(pending, p)
+				if requeueAfter == 0 || wait < requeueAfter {
+					requeueAfter = wait
+				}
+				continue
 			}
 		}
 
-		// Required Resources
-		if err := deploymentClient.Delete(
+		var err error
+		if clientSet, ok := secondaryClientsets[p.Cluster]; ok {
+			clusterCtx, cancel := r.clusterContext(ctx)
+			err = finalizeSecondaryCluster(clusterCtx, log, *replicator, p.Cluster, clientSet)
+			cancel()
+		} else if deletionPolicyFor(*replicator, p.Cluster) == plumberv1.DeletionPolicyRetain {
+			// Nothing has to be done on the cluster, so it does not need to be reachable.
+			err = nil
+		} else if clientsetErr != nil {
+			err = fmt.Errorf("no clientset for cluster %s: %w", p.Cluster, clientsetErr)
+		} else {
+			err = fmt.Errorf("cluster %s not found in kubeconfig", p.Cluster)
+		}
+
+		if err == nil {
+			r.eventf(
+				replicator,
+				corev1.EventTypeNormal,
+				"CleanedUp",
+				"Cleaned up cluster %s",
+				p.Cluster,
+			)
+			continue
+		}
+
+		log.Error(err, fmt.Sprintf("Cleanup failed for secondary cluster %s.", p.Cluster))
+		r.eventf(
+			replicator,
+			corev1.EventTypeWarning,
+			"CleanupFailed",
+			"Cleanup of cluster %s failed (attempt %d): %s",
+			p.Cluster,
+			p.Attempts+1,
+			err,
+		)
+		attemptTime := metav1.NewTime(now)
+		p.Attempts++
+		p.LastAttemptTime = &attemptTime
+		p.LastError = err.Error()
+		pending = append(pending, p)
+
+		if wait := cleanupBackoff(p.Attempts); requeueAfter == 0 || wait < requeueAfter {
+			requeueAfter = wait
+		}
+	}
+
+	if len(pending) == 0 {
+		return ctrl.Result{}, r.removeFinalizer(ctx, replicator)
+	}
+
+	timeout := replicator.Spec.CleanupTimeout
+	if timeout != nil && now.After(replicator.GetDeletionTimestamp().Add(timeout.Duration)) {
+		var clusters []string
+		for _, p := range pending {
+			clusters = append(clusters, p.Cluster)
+		}
+		r.eventf(
+			replicator,
+			corev1.EventTypeWarning,
+			"CleanupAbandoned",
+			"Cleanup timeout %s expired, resources may remain on clusters: %s",
+			timeout.Duration,
+			strings.Join(clusters, ", "),
+		)
+		return ctrl.Result{}, r.removeFinalizer(ctx, replicator)
+	}
+
+	replicator.Status.PendingCleanups = pending
+	if err := r.Status().Update(ctx, replicator); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+func (r *ReplicatorReconciler) removeFinalizer(ctx context.Context, replicator *plumberv1.Replicator) error {
+	controllerutil.RemoveFinalizer(replicator, constants.FinalizerName)
+	if err := r.Update(ctx, replicator); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete the replicated resources and the replication namespace of one cluster.
+// Resources that are already gone are ignored, so that the cleanup can be retried.
+func deleteClusterResources(
+	ctx context.Context,
+	log logr.Logger,
+	replicator plumberv1.Replicator,
+	cluster string,
+	clientSet kubernetes.Interface,
+) error {
+	var (
+		deleteErr        error
+		configMapClient  = clientSet.CoreV1().ConfigMaps(replicator.Spec.ReplicationNamespace)
+		deploymentClient = clientSet.AppsV1().Deployments(replicator.Spec.ReplicationNamespace)
+		serviceClient    = clientSet.CoreV1().Services(replicator.Spec.ReplicationNamespace)
+		ingressClient    = clientSet.NetworkingV1().Ingresses(replicator.Spec.ReplicationNamespace)
+		secretClient     = clientSet.CoreV1().Secrets(replicator.Spec.ReplicationNamespace)
+		namespaceClient  = clientSet.CoreV1().Namespaces()
+	)
+
+	if replicator.Spec.IngressSecureEnabled {
+		if err := secretClient.Delete(
+			ctx,
+			constants.ClientSecretName,
+			metav1.DeleteOptions{},
+		); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, fmt.Sprintf("Unable to delete client secret for secondary cluster %s.", cluster))
+			deleteErr = multierr.Append(deleteErr, err)
+		}
+
+		if err := secretClient.Delete(
 			ctx,
-			replicator.Spec.DeploymentName,
+			constants.IngressSecretName,
 			metav1.DeleteOptions{},
-		); err != nil {
-			log.Error(err, fmt.Sprintf("Unable to delete deployment for secondary cluster %s.", cluster))
+		); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, fmt.Sprintf("Unable to delete server secret for secondary cluster %s.", cluster))
 			deleteErr = multierr.Append(deleteErr, err)
 		}
+	}
 
-		if replicator.Spec.ConfigMapData != nil {
-			if err := configMapClient.Delete(
+	if replicator.Spec.IngressSpec != nil {
+		versions, err := versionsFor(ctx, clientSet, replicator)
+		switch _, unsupported := err.(*unsupportedVersionError); {
+		case unsupported:
+			// The cluster serves no Ingress API, so it has no Ingress to delete.
+			err = nil
+		case err != nil:
+		case versions.of(kindIngress) == networkingv1beta1.SchemeGroupVersion:
+			err = clientSet.NetworkingV1beta1().Ingresses(replicator.Spec.ReplicationNamespace).Delete(
 				ctx,
-				replicator.Spec.ConfigMapName,
+				replicator.Spec.IngressName,
 				metav1.DeleteOptions{},
-			); err != nil {
-				log.Error(err, fmt.Sprintf("Unable to delete configmap for secondary cluster %s.", cluster))
-				deleteErr = multierr.Append(deleteErr, err)
-			}
+			)
+		default:
+			err = ingressClient.Delete(
+				ctx,
+				replicator.Spec.IngressName,
+				metav1.DeleteOptions{},
+			)
 		}
+		if err != nil && !errors.IsNotFound(err) {
+			log.Error(err, fmt.Sprintf("Unable to delete ingress for secondary cluster %s.", cluster))
+			deleteErr = multierr.Append(deleteErr, err)
+		}
+	}
 
-		if err := namespaceClient.Delete(
+	if replicator.Spec.ServiceSpec != nil {
+		if err := serviceClient.Delete(
 			ctx,
-			replicator.Spec.ReplicationNamespace,
+			replicator.Spec.ServiceName,
 			metav1.DeleteOptions{},
-		); err != nil {
-			log.Error(err, fmt.Sprintf("Unable to delete namespace for secondary cluster %s.", cluster))
+		); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, fmt.Sprintf("Unable to delete service for secondary cluster %s.", cluster))
 			deleteErr = multierr.Append(deleteErr, err)
 		}
 	}
 
+	// Required Resources
+	if err := deploymentClient.Delete(
+		ctx,
+		replicator.Spec.DeploymentName,
+		metav1.DeleteOptions{},
+	); err != nil && !errors.IsNotFound(err) {
+		log.Error(err, fmt.Sprintf("Unable to delete deployment for secondary cluster %s.", cluster))
+		deleteErr = multierr.Append(deleteErr, err)
+	}
+
+	if replicator.Spec.ConfigMapData != nil {
+		if err := configMapClient.Delete(
+			ctx,
+			replicator.Spec.ConfigMapName,
+			metav1.DeleteOptions{},
+		); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, fmt.Sprintf("Unable to delete configmap for secondary cluster %s.", cluster))
+			deleteErr = multierr.Append(deleteErr, err)
+		}
+	}
+
+	if err := namespaceClient.Delete(
+		ctx,
+		replicator.Spec.ReplicationNamespace,
+		metav1.DeleteOptions{},
+	); err != nil && !errors.IsNotFound(err) {
+		log.Error(err, fmt.Sprintf("Unable to delete namespace for secondary cluster %s.", cluster))
+		deleteErr = multierr.Append(deleteErr, err)
+	}
+
 	return deleteErr
 }
 
@@ -903,22 +1969,33 @@ func deleteSecondaryClusterResources(
 //+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=endpoints,verbs=get;list;watch
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.6/pkg/reconcile
 func (r *ReplicatorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	var (
-		logger               = log.FromContext(ctx)
-		clusterDetectors     plumberv1.ClusterDetectorList
-		primaryNamespaceName string
+	ctx, span := tracing.Start(
+		ctx,
+		"Reconcile",
+		tracing.KindKey.String("Replicator"),
+		tracing.NameKey.String(req.Name),
 	)
+	result, err := r.reconcileReplicator(ctx, req)
+	tracing.End(span, err)
 
-	if err := createOwnerReferences(logger, r.Scheme); err != nil {
-		return ctrl.Result{}, err
-	}
+	return result, err
+}
+
+func (r *ReplicatorReconciler) reconcileReplicator(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var (
+		logger           = log.FromContext(ctx)
+		clusterDetectors plumberv1.ClusterDetectorList
+		replicator       plumberv1.Replicator
+	)
 
 	if err := r.Client.List(ctx, &clusterDetectors, client.InNamespace(constants.Namespace)); err != nil {
 		return ctrl.Result{}, err
@@ -931,7 +2008,7 @@ func (r *ReplicatorReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	// Generate ClientSet for primary cluster.
 	// ClientSet for primary cluster are used for replication.
-	primaryClientsets, err := cli.CreatePrimaryClientsets()
+	primaryClientsets, err := r.Clientsets.PrimaryClientsets(ctx)
 	if err != nil {
 		logger.Error(err, "Unable to create primary clientset")
 		return ctrl.Result{}, err
@@ -939,36 +2016,43 @@ func (r *ReplicatorReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	// Generate ClientSet for secondary cluster.
 	// ClientSet for secondary cluster are used for replication and Finalize.
-	secondaryClientsets, err := cli.CreateSecondaryClientsets(ctx, r.Client, replicator)
-	if err != nil {
-		logger.Error(err, "Unable to create secondary clientset")
-		return ctrl.Result{}, err
-	}
+	secondaryClientsets, err := r.Clientsets.SecondaryClientsets(ctx, replicator)
+	// The primary cluster is never replicated to as a secondary cluster.
+	primaryTargets := primaryTargetClusters(replicator, clusterDetectors.Items)
 
 	// Resources in secondary clusters are considered external resources.
 	// Therefore, they are deleted by finalizer.
-	finalizerName := "plumber.jnytnai0613.github.io/finalizer"
+	// Unreachable secondary clusters must not block the deletion,
+	// so the clientsets that could be created are used as they are.
 	if !replicator.ObjectMeta.DeletionTimestamp.IsZero() {
-		primaryNamespaceName = replicator.Spec.ReplicationNamespace
-		if controllerutil.ContainsFinalizer(&replicator, finalizerName) {
-			if err := deleteSecondaryClusterResources(ctx, logger, replicator, secondaryClientsets); err != nil {
-				logger.Error(err, "Unable to delete secondary cluster resources")
-			}
+		if !controllerutil.ContainsFinalizer(&replicator, constants.FinalizerName) {
+			return ctrl.Result{}, nil
+		}
 
-			controllerutil.RemoveFinalizer(&replicator, finalizerName)
-			if err := r.Update(ctx, &replicator); err != nil {
-				return ctrl.Result{}, err
-			}
+		if err != nil {
+			logger.Error(err, "Unable to create secondary clientset")
+		}
+
+		result, ferr := r.finalize(ctx, logger, &replicator, primaryClientsets, secondaryClientsets, primaryTargets, err)
+		if ferr != nil || controllerutil.ContainsFinalizer(&replicator, constants.FinalizerName) {
+			return result, ferr
+		}
+		r.forgetMirroredEvents(replicator)
+		r.forgetGeneration(replicator)
+		r.forgetLastRun(replicator)
+		for _, cluster := range replicator.Spec.TargetCluster {
+			r.forgetIncompatible(replicator, cluster)
 		}
 
 		// After controllerutil.RemoveFinalizer processing, the Replicator resource is deleted.
 		// Since the child resources are deleted by deleting the Replicator resource,
 		// namespace can also be deleted.
+		// Namespaces of clusters with the Orphan or Retain policy are kept.
 		if err := deletePrimaryNamespace(
 			ctx,
 			logger,
+			replicator,
 			primaryClientsets,
-			primaryNamespaceName,
 		); err != nil {
 			return ctrl.Result{}, err
 		}
@@ -976,51 +2060,339 @@ func (r *ReplicatorReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
-	if !controllerutil.ContainsFinalizer(&replicator, finalizerName) {
-		controllerutil.AddFinalizer(&replicator, finalizerName)
-		if err := r.Update(ctx, &replicator); err != nil {
+	// Target clusters without a clientset, e.g. because they are missing from the kubeconfig,
+	// are skipped, so that they do not block the replication to the other clusters.
+	if err != nil {
+		logger.Error(err, "Unable to create secondary clientset")
+		if secondaryClientsets == nil {
 			return ctrl.Result{}, err
 		}
 	}
+	unknownClusters := unknownTargetClusters(replicator, secondaryClientsets)
+	for _, cluster := range unknownClusters {
+		if primaryTargets[cluster] {
+			r.eventf(
+				&replicator,
+				corev1.EventTypeWarning,
+				"PrimaryTargetCluster",
+				"Skipped target cluster %s, it is the primary cluster",
+				cluster,
+			)
+			continue
+		}
+		r.eventf(
+			&replicator,
+			corev1.EventTypeWarning,
+			"UnknownCluster",
+			"Skipped target cluster %s, no clientset could be created for it",
+			cluster,
+		)
+	}
 
-	// Create a namespace for replication in the Primary Cluster.
-	if err := createNamespace(ctx, logger, replicator, primaryClientsets); err != nil {
-		logger.Error(err, "Unable to create namespace for primary cluster.")
+	if !controllerutil.ContainsFinalizer(&replicator, constants.FinalizerName) {
+		controllerutil.AddFinalizer(&replicator, constants.FinalizerName)
+		if err := r.Update(ctx, &replicator); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
-	// Create a namespace for replication in the Secondary Cluster.
-	if err := createNamespace(ctx, logger, replicator, secondaryClientsets); err != nil {
-		logger.Error(err, "Unable to create namespace for secondary cluster.")
+	// A rollback replaces the spec, which triggers another reconcile with the spec of the revision.
+	if replicator.Spec.RollbackTo != nil {
+		return ctrl.Result{}, r.rollbackToRevision(ctx, logger, &replicator)
 	}
 
-	// Initialize syncStatus slice once to update the status of the replicator.
-	// If not initialized, the status held in the previous Reconcile is used.
-	syncStatus = nil
-	if err := r.Replicate(ctx, logger, req, primaryClientsets, secondaryClientsets); err != nil {
-		replicator.Status.Applied = syncStatus
-		replicator.Status.Synced = "not synced"
+	// A preview only reports what would change on each cluster.
+	// The rest of the status keeps showing the last real sync.
+	if replicator.Spec.DryRun {
+		result, err := r.Preview(ctx, logger, req, replicator, primaryClientsets, secondaryClientsets)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Dry run reported problems: %s", err))
+		}
+		replicator.Status.DryRun = &plumberv1.DryRunStatus{
+			ObservedGeneration: replicator.GetGeneration(),
+			Results:            result.DryRun,
+		}
 		if err := r.Status().Update(ctx, &replicator); err != nil {
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
+
+		return ctrl.Result{}, nil
 	}
 
-	replicator.Status.Applied = syncStatus
-	replicator.Status.Synced = "synced"
+	// While the Replicator is suspended, nothing is applied and the rollout does not progress.
+	// All clusters are still checked, so that the status shows any drift.
+	suspended := isSuspended(replicator)
+
+	// With a rollout strategy, only the clusters of the waves that have been started are replicated to.
+	// After a rollback the primary cluster does not get the new spec either, see rollbackCanary.
+	var plan rolloutPlan
+	primaries := primaryClientsets
+	targets := secondaryClientsets
+	if replicator.Spec.Rollout == nil {
+		replicator.Status.Rollout = nil
+	} else if !suspended {
+		plan, err = planRollout(replicator, clusterDetectors.Items)
+		if err != nil {
+			logger.Error(err, "Unable to plan rollout")
+			return ctrl.Result{}, err
+		}
+		status := startRollout(&replicator)
+		targets = rolloutTargets(plan, status, secondaryClientsets)
+		if status.Phase == plumberv1.RolloutPhaseRolledBack {
+			primaries = nil
+		}
+	}
+
+	// In atomic mode, nothing is applied unless a dry run succeeds on all clusters.
+	replicate := r.Replicate
+	if replicator.Spec.SyncPolicy != nil && replicator.Spec.SyncPolicy.Atomic && !suspended {
+		replicate = r.replicateAtomically
+	}
+
+	// The namespace for replication is created in each cluster before the resources are applied.
+	r.startGeneration(replicator)
+	start := metav1.Now()
+	result, replicateErr := replicate(ctx, logger, req, replicator, primaries, targets)
+	result.Clusters = withUnknownClusters(result.Clusters, unknownClusters, primaryTargets)
+	r.mirrorEvents(ctx, logger, &replicator, result.Clusters, targets)
+	if result.DryRun != nil {
+		replicator.Status.DryRun = &plumberv1.DryRunStatus{
+			ObservedGeneration: replicator.GetGeneration(),
+			Results:            result.DryRun,
+		}
+	}
+	replicator.Status.LastHandledSyncNow = replicator.GetAnnotations()[constants.SyncNowAnnotation]
+
+	requeue := ctrl.Result{RequeueAfter: result.RetryAfter}
+	if replicator.Spec.Rollout != nil && !suspended {
+		rolloutResult := r.progressRollout(ctx, logger, &replicator, plan, targets, result)
+		requeue.Requeue = rolloutResult.Requeue
+		if d := rolloutResult.RequeueAfter; d > 0 && (requeue.RequeueAfter == 0 || d < requeue.RequeueAfter) {
+			requeue.RequeueAfter = d
+		}
+
+		// After a failed canary analysis the primary and canary clusters are kept on the stable spec.
+		if replicator.Status.Rollout.Phase == plumberv1.RolloutPhaseRolledBack {
+			result, err = r.rollbackCanary(ctx, logger, req, replicator, result, plan[0], primaryClientsets, secondaryClientsets)
+			if err != nil {
+				replicateErr = multierr.Append(replicateErr, err)
+			}
+		}
+	}
+
+	// Skipped clusters are not synced, but they are not retried with the rate limiter either.
+	// The Replicator is requeued when the next probe of the skipped clusters is allowed.
+	replicator.Status.Applied = result.Applied
+	replicator.Status.Clusters = withLastSyncTime(replicator.Status.Clusters, result.Clusters)
+	replicator.Status.ObservedGeneration = replicator.GetGeneration()
+	replicator.Status.SucceededClusters,
+		replicator.Status.FailedClusters,
+		replicator.Status.SkippedClusters = countClusters(result.Clusters)
+	primaryClusters := make(map[string]bool)
+	for cluster := range primaryClientsets {
+		primaryClusters[cluster] = true
+	}
+	replicator.Status.Synced, err = syncState(replicator, result.Clusters, primaryClusters)
+	if err != nil {
+		logger.Error(err, "Unable to determine sync state")
+	}
+	if replicator.Spec.Rollout != nil && !suspended &&
+		replicator.Status.Rollout.Phase != plumberv1.RolloutPhaseCompleted &&
+		replicator.Status.Synced == plumberv1.SyncStateSynced {
+		replicator.Status.Synced = plumberv1.SyncStateDegraded
+	}
+
+	if replicator.Status.Synced == plumberv1.SyncStateSynced && !suspended {
+		r.observeReplicationLag(replicator)
+	}
+
+	// The spec that has been synced to all clusters is recorded as a revision.
+	// Canary clusters and failed atomic syncs are rolled back to the newest revision.
+	if replicator.Status.Synced == plumberv1.SyncStateSynced && !suspended {
+		if err := r.recordRevision(ctx, logger, &replicator); err != nil {
+			logger.Error(err, "Unable to record revision")
+			replicateErr = multierr.Append(replicateErr, err)
+		}
+	}
+
+	// Every sync that changed a resource on any cluster is kept for auditing.
+	if len(result.Changes) > 0 {
+		if err := r.recordRun(ctx, logger, replicator, start, result); err != nil {
+			logger.Error(err, "Unable to record ReplicationRun")
+		}
+	}
+
+	// The health is read right after the apply, so it is refreshed until the workload has become healthy.
+	replicator.Status.Health = fleetHealth(replicator.Status.Clusters)
+	if unhealthyWorkload(replicator.Status.Clusters) &&
+		(requeue.RequeueAfter == 0 || healthPollInterval < requeue.RequeueAfter) {
+		requeue.RequeueAfter = healthPollInterval
+	}
+	setReplicatorConditions(&replicator, suspended)
 	if err := r.Status().Update(ctx, &replicator); err != nil {
 		return ctrl.Result{}, err
 	}
+	if replicateErr != nil {
+		return ctrl.Result{}, replicateErr
+	}
+
+	return requeue, nil
+}
+
+// Return the target clusters for which no clientset has been created.
+func unknownTargetClusters(
+	replicator plumberv1.Replicator,
+	secondaryClientsets map[string]kubernetes.Interface,
+) []string {
+	var unknown []string
+	for _, cluster := range replicator.Spec.TargetCluster {
+		if _, ok := secondaryClientsets[cluster]; !ok {
+			unknown = append(unknown, cluster)
+		}
+	}
+
+	return unknown
+}
+
+// Return the target clusters whose ClusterDetector has .spec.primary.
+func primaryTargetClusters(
+	replicator plumberv1.Replicator,
+	clusterDetectors []plumberv1.ClusterDetector,
+) map[string]bool {
+	primaries := make(map[string]bool)
+	for _, clusterDetector := range clusterDetectors {
+		if clusterDetector.Spec.Primary {
+			primaries[clusterDetector.GetName()] = true
+		}
+	}
 
-	return ctrl.Result{}, nil
+	targets := make(map[string]bool)
+	for _, cluster := range replicator.Spec.TargetCluster {
+		if primaries[cluster] {
+			targets[cluster] = true
+		}
+	}
+
+	return targets
+}
+
+// Add the unknown target clusters to the result of the replication as skipped.
+func withUnknownClusters(
+	clusters []plumberv1.ClusterSyncStatus,
+	unknown []string,
+	primaryTargets map[string]bool,
+) []plumberv1.ClusterSyncStatus {
+	if len(unknown) == 0 {
+		return clusters
+	}
+
+	for _, cluster := range unknown {
+		message := "no clientset for the cluster, e.g. not found in kubeconfig"
+		if primaryTargets[cluster] {
+			message = "the primary cluster cannot be a target cluster"
+		}
+		clusters = append(clusters, plumberv1.ClusterSyncStatus{
+			Cluster: cluster,
+			State:   plumberv1.ClusterSyncStateSkipped,
+			Message: message,
+		})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Cluster < clusters[j].Cluster
+	})
+
+	return clusters
+}
+
+// Replicate the stable spec to the primary cluster and the canary clusters,
+// since the primary cluster gets the new spec before any wave.
+// The entries of these clusters in the result are replaced with the result of the rollback.
+func (r *ReplicatorReconciler) rollbackCanary(
+	ctx context.Context,
+	log logr.Logger,
+	req ctrl.Request,
+	replicator plumberv1.Replicator,
+	result ReplicateResult,
+	canaryClusters []string,
+	primaryClientsets map[string]kubernetes.Interface,
+	secondaryClientsets map[string]kubernetes.Interface,
+) (ReplicateResult, error) {
+	stable, ok, err := r.stableReplicator(ctx, replicator)
+	if err != nil {
+		return result, err
+	}
+	if !ok {
+		return result, fmt.Errorf("no revision to roll back canary clusters to")
+	}
+
+	targets := make(map[string]kubernetes.Interface)
+	for _, cluster := range canaryClusters {
+		if clientSet, ok := secondaryClientsets[cluster]; ok {
+			targets[cluster] = clientSet
+		}
+	}
+
+	rollback, err := r.Replicate(ctx, log, req, stable, primaryClientsets, targets)
+	if err != nil {
+		err = fmt.Errorf("failed to roll back canary clusters: %w", err)
+	}
+
+	rolledBack := make(map[string]bool)
+	for _, c := range rollback.Clusters {
+		rolledBack[c.Cluster] = true
+	}
+
+	var applied []plumberv1.PerResourceApplyStatus
+	for _, s := range result.Applied {
+		if !rolledBack[s.Cluster] {
+			applied = append(applied, s)
+		}
+	}
+	result.Applied = append(applied, rollback.Applied...)
+	sort.SliceStable(result.Applied, func(i, j int) bool {
+		return result.Applied[i].Cluster < result.Applied[j].Cluster
+	})
+	result.Changes = append(result.Changes, rollback.Changes...)
+	sort.SliceStable(result.Changes, func(i, j int) bool {
+		return result.Changes[i].Cluster < result.Changes[j].Cluster
+	})
+
+	var clusters []plumberv1.ClusterSyncStatus
+	for _, c := range result.Clusters {
+		if !rolledBack[c.Cluster] {
+			clusters = append(clusters, c)
+		}
+	}
+	for _, c := range rollback.Clusters {
+		switch c.State {
+		case plumberv1.ClusterSyncStateApplied:
+			c.State = plumberv1.ClusterSyncStateRolledBack
+			c.Message = "rolled back to the stable spec, the canary analysis failed"
+		case plumberv1.ClusterSyncStateFailed:
+			c.Message = fmt.Sprintf("rollback failed: %s", c.Message)
+		}
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Cluster < clusters[j].Cluster
+	})
+	result.Clusters = clusters
+
+	return result, err
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ReplicatorReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.startTime = time.Now()
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&plumberv1.Replicator{}).
 		Owns(&corev1.ConfigMap{}).
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
 		Owns(&networkv1.Ingress{}).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+		}).
 		Complete(r)
 }
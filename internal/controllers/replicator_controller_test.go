@@ -0,0 +1,2299 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	networkv1apply "k8s.io/client-go/applyconfigurations/networking/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/constants"
+)
+
+const (
+	testPrimaryCluster   = "kubernetes.kubernetes-admin"
+	testSecondaryCluster = "secondary.kubernetes-admin2"
+)
+
+type fakeClientsetProvider struct {
+	primary     kubernetes.Interface
+	secondaries map[string]kubernetes.Interface
+
+	mu                   sync.Mutex
+	invalidated          []string
+	invalidatedDiscovery []string
+}
+
+func (p *fakeClientsetProvider) PrimaryClientsets(context.Context) (map[string]kubernetes.Interface, error) {
+	return map[string]kubernetes.Interface{testPrimaryCluster: p.primary}, nil
+}
+
+func (p *fakeClientsetProvider) SecondaryClientsets(
+	ctx context.Context,
+	replicator plumberv1.Replicator,
+) (map[string]kubernetes.Interface, error) {
+	clientsets := make(map[string]kubernetes.Interface)
+	for _, cluster := range replicator.Spec.TargetCluster {
+		if cs, ok := p.secondaries[cluster]; ok {
+			clientsets[cluster] = cs
+		}
+	}
+
+	return clientsets, nil
+}
+
+func (p *fakeClientsetProvider) Invalidate(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.invalidated = append(p.invalidated, name)
+}
+
+func (p *fakeClientsetProvider) InvalidateDiscovery(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.invalidatedDiscovery = append(p.invalidatedDiscovery, name)
+}
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := plumberv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	return scheme
+}
+
+func newTestReplicator(i int) *plumberv1.Replicator {
+	template := corev1apply.PodTemplateSpec().
+		WithSpec(corev1apply.PodSpec().
+			WithContainers(corev1apply.Container().
+				WithName("nginx").
+				WithImage("nginx:latest")))
+
+	return &plumberv1.Replicator{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("replicator-%d", i),
+			UID:  types.UID(fmt.Sprintf("uid-%d", i)),
+		},
+		Spec: plumberv1.ReplicatorSpec{
+			ReplicationNamespace: fmt.Sprintf("ns-%d", i),
+			DeploymentName:       fmt.Sprintf("app-%d", i),
+			DeploymentSpec: &plumberv1.DeploymentSpecApplyConfiguration{
+				Template: template,
+			},
+			ConfigMapName: fmt.Sprintf("cm-%d", i),
+			ConfigMapData: map[string]string{"index.html": fmt.Sprintf("replicator-%d", i)},
+			TargetCluster: []string{testSecondaryCluster},
+		},
+	}
+}
+
+// The fake clientset cannot apply to missing objects,
+// so the objects to be replicated are created in advance.
+func newTestClientset(n int) *k8sfake.Clientset {
+	var objects []runtime.Object
+	for i := 0; i < n; i++ {
+		objects = append(objects,
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("app-%d", i),
+				Namespace: fmt.Sprintf("ns-%d", i),
+			}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("cm-%d", i),
+				Namespace: fmt.Sprintf("ns-%d", i),
+			}},
+		)
+	}
+
+	return k8sfake.NewSimpleClientset(objects...)
+}
+
+func TestReconcileReplicatorsConcurrently(t *testing.T) {
+	const n = 20
+
+	var (
+		ctx       = context.Background()
+		scheme    = newTestScheme(t)
+		primary   = newTestClientset(n)
+		secondary = newTestClientset(n)
+		objects   []client.Object
+	)
+	for i := 0; i < n; i++ {
+		objects = append(objects, newTestReplicator(i))
+	}
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(objects...).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     primary,
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		MaxConcurrentClusters:   2,
+		MaxConcurrentReconciles: n,
+		Recorder:                &record.FakeRecorder{},
+		Scheme:                  scheme,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: fmt.Sprintf("replicator-%d", i)}}
+			if _, err := r.Reconcile(ctx, req); err != nil {
+				t.Errorf("replicator-%d: reconcile failed: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		var replicator plumberv1.Replicator
+		if err := r.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("replicator-%d", i)}, &replicator); err != nil {
+			t.Fatal(err)
+		}
+
+		if replicator.Status.Synced != plumberv1.SyncStateSynced {
+			t.Errorf("replicator-%d: expected Synced, got %q", i, replicator.Status.Synced)
+		}
+		if !meta.IsStatusConditionTrue(replicator.Status.Conditions, plumberv1.ReplicatorConditionReady) {
+			t.Errorf("replicator-%d: expected Ready, got %v", i, replicator.Status.Conditions)
+		}
+		for _, c := range replicator.Status.Clusters {
+			if c.LastSyncTime == nil {
+				t.Errorf("replicator-%d: expected lastSyncTime on %s", i, c.Cluster)
+			}
+		}
+
+		// Two resources on each of the two clusters, none of them belonging to another Replicator.
+		if len(replicator.Status.Applied) != 4 {
+			t.Errorf("replicator-%d: expected 4 applied resources, got %v", i, replicator.Status.Applied)
+		}
+		for _, s := range replicator.Status.Applied {
+			if s.Name != fmt.Sprintf("app-%d", i) && s.Name != fmt.Sprintf("cm-%d", i) {
+				t.Errorf("replicator-%d: unexpected resource in status: %v", i, s)
+			}
+		}
+
+		clusters := replicator.Status.Clusters
+		if len(clusters) != 2 || clusters[0].Cluster != testPrimaryCluster || clusters[1].Cluster != testSecondaryCluster {
+			t.Errorf("replicator-%d: expected per-cluster status sorted by cluster, got %v", i, clusters)
+		}
+
+		deployment, err := primary.AppsV1().Deployments(fmt.Sprintf("ns-%d", i)).Get(
+			ctx,
+			fmt.Sprintf("app-%d", i),
+			metav1.GetOptions{},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		refs := deployment.GetOwnerReferences()
+		if len(refs) != 1 || refs[0].UID != replicator.GetUID() || refs[0].Name != replicator.GetName() {
+			t.Errorf("replicator-%d: unexpected owner references %v", i, refs)
+		}
+		if deployment.GetLabels()[constants.ReplicatorLabel] != replicator.GetName() {
+			t.Errorf("replicator-%d: unexpected labels %v", i, deployment.GetLabels())
+		}
+	}
+}
+
+// Return a clientset of a cluster that never answers, but gives up as soon as the request is cancelled.
+// The fake clientset ignores the context, so a real one is used.
+// enter and leave, if not nil, are called around each request.
+func newHungClientset(t *testing.T, enter, leave func()) kubernetes.Interface {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if enter != nil {
+			enter()
+			defer leave()
+		}
+		// The cancellation of the request is only noticed once its body has been read.
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	clientSet, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return clientSet
+}
+
+func TestReplicateClusterConcurrency(t *testing.T) {
+	const (
+		workers      = 2
+		hungCluster  = "hung.kubernetes-admin"
+		clusterCount = 6
+	)
+
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		replicator = newTestReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+		secondary  = make(map[string]kubernetes.Interface)
+
+		mu           sync.Mutex
+		active, peak int
+	)
+	enter := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		active++
+		if active > peak {
+			peak = active
+		}
+	}
+	leave := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		active--
+	}
+
+	// Applying the Deployment blocks for a while, so that the clusters overlap.
+	for i := 0; i < clusterCount; i++ {
+		cluster := fmt.Sprintf("secondary-%d.kubernetes-admin", i)
+		clientSet := newTestClientset(1)
+		clientSet.PrependReactor("patch", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+			enter()
+			defer leave()
+			time.Sleep(20 * time.Millisecond)
+			return false, nil, nil
+		})
+		secondary[cluster] = clientSet
+		replicator.Spec.TargetCluster = append(replicator.Spec.TargetCluster, cluster)
+	}
+
+	secondary[hungCluster] = newHungClientset(t, enter, leave)
+	replicator.Spec.TargetCluster = append(replicator.Spec.TargetCluster, hungCluster)
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     newTestClientset(1),
+			secondaries: secondary,
+		},
+		ClusterTimeout:        500 * time.Millisecond,
+		MaxConcurrentClusters: workers,
+		Recorder:              &record.FakeRecorder{},
+		Scheme:                scheme,
+	}
+
+	start := time.Now()
+	if _, err := r.Reconcile(ctx, req); err == nil {
+		t.Error("expected the hung cluster to fail the sync")
+	}
+	// The hung cluster holds a single worker, so the other clusters are not queued behind it.
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the hung cluster to be given up on after its timeout, took %s", elapsed)
+	}
+	if peak > workers {
+		t.Errorf("expected at most %d clusters at a time, got %d", workers, peak)
+	}
+
+	var current plumberv1.Replicator
+	if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+		t.Fatal(err)
+	}
+	states := make(map[string]plumberv1.ClusterSyncStatus)
+	for _, c := range current.Status.Clusters {
+		states[c.Cluster] = c
+	}
+	if c := states[hungCluster]; c.State != plumberv1.ClusterSyncStateFailed ||
+		!strings.Contains(c.Message, context.DeadlineExceeded.Error()) {
+		t.Errorf("expected the hung cluster to time out, got %+v", c)
+	}
+	for cluster := range secondary {
+		if cluster == hungCluster {
+			continue
+		}
+		if c := states[cluster]; c.State != plumberv1.ClusterSyncStateApplied {
+			t.Errorf("expected %s to be applied, got %+v", cluster, c)
+		}
+	}
+}
+
+func markDeploymentAvailable(t *testing.T, clientSet kubernetes.Interface, namespace, name string) {
+	deployment, err := clientSet.AppsV1().Deployments(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deployment.Status.UpdatedReplicas = 1
+	deployment.Status.ReadyReplicas = 1
+	deployment.Status.AvailableReplicas = 1
+	deployment.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type:   appsv1.DeploymentAvailable,
+		Status: corev1.ConditionTrue,
+	}}
+	if _, err := clientSet.AppsV1().Deployments(namespace).UpdateStatus(
+		context.Background(),
+		deployment,
+		metav1.UpdateOptions{},
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconcileRolloutWaves(t *testing.T) {
+	const (
+		firstCluster  = "first.kubernetes-admin2"
+		secondCluster = "second.kubernetes-admin3"
+	)
+
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		first      = newTestClientset(1)
+		second     = newTestClientset(1)
+		replicator = newTestReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	)
+	replicator.Spec.TargetCluster = []string{firstCluster, secondCluster}
+	replicator.Spec.Rollout = &plumberv1.RolloutStrategy{
+		Waves: []plumberv1.RolloutWave{{Name: "canary", Clusters: []string{firstCluster}}},
+	}
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary: newTestClientset(1),
+			secondaries: map[string]kubernetes.Interface{
+				firstCluster:  first,
+				secondCluster: second,
+			},
+		},
+		Recorder: &record.FakeRecorder{},
+		Scheme:   scheme,
+	}
+
+	reconcile := func() (ctrl.Result, *plumberv1.RolloutStatus) {
+		result, err := r.Reconcile(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var current plumberv1.Replicator
+		if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+			t.Fatal(err)
+		}
+		return result, current.Status.Rollout
+	}
+
+	replicatedTo := func(clientSet kubernetes.Interface) bool {
+		deployment, err := clientSet.AppsV1().Deployments("ns-0").Get(ctx, "app-0", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return deployment.GetLabels()[constants.ReplicatorLabel] == replicator.GetName()
+	}
+
+	// Only the first wave is replicated to until its Deployment becomes Available.
+	result, status := reconcile()
+	if status.Phase != plumberv1.RolloutPhaseProgressing || status.CurrentWave != 0 || result.RequeueAfter == 0 {
+		t.Fatalf("expected the first wave to be in progress, got %+v, %+v", status, result)
+	}
+	if !replicatedTo(first) || replicatedTo(second) {
+		t.Fatal("expected only the first wave to be replicated to")
+	}
+
+	markDeploymentAvailable(t, first, "ns-0", "app-0")
+	if result, status = reconcile(); status.CurrentWave != 1 || !result.Requeue {
+		t.Fatalf("expected the implicit final wave to be started, got %+v, %+v", status, result)
+	}
+
+	if _, status = reconcile(); !replicatedTo(second) {
+		t.Fatal("expected the final wave to be replicated to")
+	}
+
+	markDeploymentAvailable(t, second, "ns-0", "app-0")
+	if _, status = reconcile(); status.Phase != plumberv1.RolloutPhaseCompleted {
+		t.Fatalf("expected the rollout to be completed, got %+v", status)
+	}
+}
+
+func TestReconcileCanaryRollback(t *testing.T) {
+	const (
+		canaryCluster = "canary.kubernetes-admin2"
+		otherCluster  = "other.kubernetes-admin3"
+	)
+
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		primary    = newTestClientset(1)
+		canary     = newTestClientset(1)
+		other      = newTestClientset(1)
+		replicator = newTestReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	)
+	replicator.Spec.TargetCluster = []string{canaryCluster, otherCluster}
+	stable, err := newRevision(*replicator, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicator.Status.CurrentRevision = 1
+	replicator.Spec.DeploymentSpec.Template.Spec.Containers[0].WithImage("nginx:broken")
+	replicator.Spec.Rollout = &plumberv1.RolloutStrategy{
+		Canary: &plumberv1.CanaryStrategy{
+			Clusters: []string{canaryCluster},
+			BakeTime: &metav1.Duration{Duration: time.Hour},
+		},
+	}
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator, stable).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary: primary,
+			secondaries: map[string]kubernetes.Interface{
+				canaryCluster: canary,
+				otherCluster:  other,
+			},
+		},
+		Recorder: &record.FakeRecorder{},
+		Scheme:   scheme,
+	}
+
+	image := func(clientSet kubernetes.Interface) string {
+		deployment, err := clientSet.AppsV1().Deployments("ns-0").Get(ctx, "app-0", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deployment.Spec.Template.Spec.Containers) == 0 {
+			return ""
+		}
+		return deployment.Spec.Template.Spec.Containers[0].Image
+	}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if image(canary) != "nginx:broken" || image(other) != "" {
+		t.Fatal("expected only the canary cluster to get the change")
+	}
+
+	// The Deployment becomes Available, but one of its pods is crash looping.
+	markDeploymentAvailable(t, canary, "ns-0", "app-0")
+	if _, err := canary.CoreV1().Pods("ns-0").Create(ctx, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-0-xyz", Labels: map[string]string{"apps": "nginx"}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "nginx",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		}}},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	var current plumberv1.Replicator
+	if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+		t.Fatal(err)
+	}
+	if current.Status.Rollout.Phase != plumberv1.RolloutPhaseRolledBack ||
+		current.Status.Rollout.Canary.Phase != plumberv1.CanaryPhaseFailed {
+		t.Fatalf("expected the canary to be rolled back, got %+v", current.Status.Rollout)
+	}
+	if image(canary) != "nginx:latest" || image(other) != "" {
+		t.Fatalf("expected the canary cluster to run the stable spec, got %q", image(canary))
+	}
+	// The primary cluster got the change before the canary clusters, so it is rolled back as well.
+	if image(primary) != "nginx:latest" {
+		t.Fatalf("expected the primary cluster to run the stable spec, got %q", image(primary))
+	}
+
+	// The canary cluster is listed once, with the result of the rollback.
+	var canaryStates []string
+	for _, c := range current.Status.Clusters {
+		if c.Cluster == canaryCluster {
+			canaryStates = append(canaryStates, c.State)
+		}
+	}
+	if len(canaryStates) != 1 || canaryStates[0] != plumberv1.ClusterSyncStateRolledBack {
+		t.Errorf("expected the canary cluster to be rolled back once, got %v", canaryStates)
+	}
+	applied := make(map[string]int)
+	for _, s := range current.Status.Applied {
+		applied[fmt.Sprintf("%s/%s/%s", s.Cluster, s.Kind, s.Name)]++
+	}
+	for resource, n := range applied {
+		if n != 1 {
+			t.Errorf("expected %s to be listed once, got %d", resource, n)
+		}
+	}
+	if s := current.Status; s.SucceededClusters != 0 || s.FailedClusters != 2 || s.Synced != plumberv1.SyncStateFailed {
+		t.Errorf("expected the primary and canary clusters to be rolled back, got %d succeeded, %d failed, %q",
+			s.SucceededClusters, s.FailedClusters, s.Synced)
+	}
+
+	// The primary cluster is not updated again while the rollout is rolled back.
+	primary.ClearActions()
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range primary.Actions() {
+		if patch, ok := action.(k8stesting.PatchAction); ok && strings.Contains(string(patch.GetPatch()), "nginx:broken") {
+			t.Errorf("unexpected apply of the new spec to the primary cluster: %s", patch.GetPatch())
+		}
+	}
+	if image(primary) != "nginx:latest" || image(canary) != "nginx:latest" {
+		t.Errorf("expected the stable spec to be kept, got %q and %q", image(primary), image(canary))
+	}
+}
+
+func TestBakeCanaryClusterTimeout(t *testing.T) {
+	replicator := newTestReplicator(0)
+	replicator.Spec.Rollout = &plumberv1.RolloutStrategy{
+		Canary: &plumberv1.CanaryStrategy{Clusters: []string{testSecondaryCluster}},
+	}
+	replicator.Status.Rollout = &plumberv1.RolloutStatus{}
+
+	r := &ReplicatorReconciler{ClusterTimeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	_, err := r.bakeCanary(
+		context.Background(),
+		replicator,
+		[]string{testSecondaryCluster},
+		map[string]kubernetes.Interface{testSecondaryCluster: newHungClientset(t, nil, nil)},
+	)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the analysis of the hung cluster to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the analysis of the hung cluster to be cut off, took %s", elapsed)
+	}
+}
+
+func TestReconcileSuspended(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		primary    = newTestClientset(1)
+		secondary  = newTestClientset(1)
+		replicator = newTestReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	)
+	replicator.Spec.Suspend = true
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     primary,
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		Recorder: &record.FakeRecorder{},
+		Scheme:   scheme,
+	}
+
+	reconcile := func() plumberv1.Replicator {
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+		var current plumberv1.Replicator
+		if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+			t.Fatal(err)
+		}
+		return current
+	}
+
+	replicated := func() bool {
+		deployment, err := secondary.AppsV1().Deployments("ns-0").Get(ctx, "app-0", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return deployment.GetLabels()[constants.ReplicatorLabel] == replicator.GetName()
+	}
+
+	// Nothing is applied, the differences are reported as drift.
+	current := reconcile()
+	if replicated() {
+		t.Fatal("expected nothing to be applied while suspended")
+	}
+	if current.Status.Synced != plumberv1.SyncStateFailed {
+		t.Errorf("expected Failed, got %q", current.Status.Synced)
+	}
+	for _, c := range current.Status.Clusters {
+		if c.State != plumberv1.ClusterSyncStateDrifted {
+			t.Errorf("expected %s to be drifted, got %s", c.Cluster, c.State)
+		}
+	}
+
+	// The sync-now annotation applies the Replicator once.
+	current.SetAnnotations(map[string]string{constants.SyncNowAnnotation: "1"})
+	if err := r.Update(ctx, &current); err != nil {
+		t.Fatal(err)
+	}
+	current = reconcile()
+	if !replicated() {
+		t.Fatal("expected the Replicator to be applied on sync-now")
+	}
+	if current.Status.LastHandledSyncNow != "1" || current.Status.Synced != plumberv1.SyncStateSynced {
+		t.Errorf("unexpected status %+v", current.Status)
+	}
+	if !isSuspended(current) {
+		t.Error("expected the Replicator to be suspended again after the sync")
+	}
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		primary    = newTestClientset(1)
+		secondary  = newTestClientset(1)
+		replicator = newTestReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	)
+	replicator.Spec.DryRun = true
+
+	// The secondary cluster rejects the Deployment, e.g. by an admission webhook.
+	secondary.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(
+			schema.GroupResource{Group: "apps", Resource: "deployments"},
+			"app-0",
+			fmt.Errorf("denied by policy"),
+		)
+	})
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     primary,
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		Recorder: &record.FakeRecorder{},
+		Scheme:   scheme,
+	}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	var current plumberv1.Replicator
+	if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+		t.Fatal(err)
+	}
+
+	if current.Status.DryRun == nil {
+		t.Fatal("expected a dry run status")
+	}
+	if len(current.Status.Applied) != 0 || current.Status.Synced != "" {
+		t.Errorf("expected the sync status to be left alone, got %+v", current.Status)
+	}
+
+	// Namespace, ConfigMap and Deployment on both clusters.
+	results := current.Status.DryRun.Results
+	if len(results) != 6 {
+		t.Fatalf("expected 6 results, got %+v", results)
+	}
+	for _, result := range results {
+		rejected := result.Cluster == testSecondaryCluster && result.Kind == "Deployment"
+		if rejected != (result.Action == plumberv1.DryRunActionRejected) {
+			t.Errorf("unexpected result %+v", result)
+		}
+	}
+}
+
+func TestReconcileAtomic(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		primary    = newTestClientset(1)
+		secondary  = newTestClientset(1)
+		replicator = newTestReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	)
+	stable, err := newRevision(*replicator, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicator.Status.CurrentRevision = 1
+	replicator.Spec.DeploymentSpec.Template.Spec.Containers[0].WithImage("nginx:new")
+	replicator.Spec.SyncPolicy = &plumberv1.SyncPolicy{Atomic: true}
+
+	// The dry run passes on the secondary cluster, but the real apply of the Deployment fails.
+	var patches int
+	secondary.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches++
+		if patches == 2 {
+			return true, nil, fmt.Errorf("connection reset by peer")
+		}
+		return false, nil, nil
+	})
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator, stable).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     primary,
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		Recorder: &record.FakeRecorder{},
+		Scheme:   scheme,
+	}
+
+	if _, err := r.Reconcile(ctx, req); err == nil {
+		t.Fatal("expected the atomic sync to fail")
+	}
+	var current plumberv1.Replicator
+	if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+		t.Fatal(err)
+	}
+
+	// The primary cluster was updated before the secondary cluster failed, so it is rolled back.
+	states := make(map[string]string)
+	for _, c := range current.Status.Clusters {
+		states[c.Cluster] = c.State
+	}
+	if states[testPrimaryCluster] != plumberv1.ClusterSyncStateRolledBack ||
+		states[testSecondaryCluster] != plumberv1.ClusterSyncStateFailed {
+		t.Fatalf("unexpected cluster states %v", states)
+	}
+
+	deployment, err := primary.AppsV1().Deployments("ns-0").Get(ctx, "app-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "nginx:latest" {
+		t.Errorf("expected the primary cluster to be rolled back, got %q", image)
+	}
+}
+
+func TestSyncState(t *testing.T) {
+	clusters := func(states ...string) []plumberv1.ClusterSyncStatus {
+		var cs []plumberv1.ClusterSyncStatus
+		for i, state := range states {
+			cs = append(cs, plumberv1.ClusterSyncStatus{Cluster: fmt.Sprintf("cluster-%d", i), State: state})
+		}
+		return cs
+	}
+	primary := map[string]bool{"cluster-0": true}
+	applied, failed, skipped :=
+		plumberv1.ClusterSyncStateApplied, plumberv1.ClusterSyncStateFailed, plumberv1.ClusterSyncStateSkipped
+
+	for _, tc := range []struct {
+		name     string
+		min      *intstr.IntOrString
+		clusters []plumberv1.ClusterSyncStatus
+		want     string
+	}{
+		{"all applied", nil, clusters(applied, applied, applied), plumberv1.SyncStateSynced},
+		{"no quorum", nil, clusters(applied, applied, failed), plumberv1.SyncStateFailed},
+		{"count reached", intPtr(2), clusters(applied, applied, skipped), plumberv1.SyncStateDegraded},
+		{"count not reached", intPtr(3), clusters(applied, applied, failed, failed), plumberv1.SyncStateFailed},
+		{"percentage reached", percentPtr("50%"), clusters(applied, applied, failed, failed), plumberv1.SyncStateDegraded},
+		{"percentage rounded up", percentPtr("60%"), clusters(applied, applied, failed, failed), plumberv1.SyncStateFailed},
+		{"primary failed", intPtr(1), clusters(failed, applied, applied), plumberv1.SyncStateFailed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var replicator plumberv1.Replicator
+			replicator.Spec.SyncPolicy = &plumberv1.SyncPolicy{MinSuccessfulClusters: tc.min}
+			got, err := syncState(replicator, tc.clusters, primary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func intPtr(i int) *intstr.IntOrString {
+	v := intstr.FromInt(i)
+	return &v
+}
+
+func percentPtr(s string) *intstr.IntOrString {
+	v := intstr.FromString(s)
+	return &v
+}
+
+func TestWorkloadHealth(t *testing.T) {
+	ctx := context.Background()
+
+	var replicator plumberv1.Replicator
+	replicator.Spec.ReplicationNamespace = "ns-0"
+	replicator.Spec.DeploymentName = "app-0"
+	replicator.Spec.ServiceName = "svc-0"
+	replicator.Spec.ServiceSpec = &plumberv1.ServiceSpecApplyConfiguration{}
+	replicator.Spec.IngressName = "ing-0"
+	replicator.Spec.IngressSpec = &plumberv1.IngressSpecApplyConfiguration{}
+
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns-0", Name: "app-0"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 2, AvailableReplicas: 2},
+	}
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns-0", Name: "svc-0"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses:         []corev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+			NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.3"}},
+		}},
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns-0", Name: "ing-0"},
+		Status: networkingv1.IngressStatus{LoadBalancer: networkingv1.IngressLoadBalancerStatus{
+			Ingress: []networkingv1.IngressLoadBalancerIngress{{IP: "192.0.2.1"}, {Hostname: "lb.example.com"}},
+		}},
+	}
+
+	healthy := workloadHealth(ctx, replicator, k8sfake.NewSimpleClientset(deployment, endpoints, ingress), nil)
+	if healthy.State != plumberv1.WorkloadHealthHealthy ||
+		healthy.ReadyEndpoints != 2 || healthy.NotReadyEndpoints != 1 ||
+		fmt.Sprint(healthy.IngressAddresses) != "[192.0.2.1 lb.example.com]" {
+		t.Errorf("unexpected health %+v", healthy)
+	}
+
+	deployment.Status.AvailableReplicas = 1
+	unhealthy := workloadHealth(ctx, replicator, k8sfake.NewSimpleClientset(deployment, endpoints, ingress), nil)
+	if unhealthy.State != plumberv1.WorkloadHealthUnhealthy || unhealthy.Message != "1 of 2 replicas available" {
+		t.Errorf("unexpected health %+v", unhealthy)
+	}
+
+	fleet := fleetHealth([]plumberv1.ClusterSyncStatus{
+		{Cluster: testPrimaryCluster, Workload: healthy},
+		{Cluster: testSecondaryCluster, Workload: unhealthy},
+		{Cluster: "skipped.kubernetes-admin3", State: plumberv1.ClusterSyncStateSkipped},
+	})
+	if fleet.State != plumberv1.FleetHealthDegraded || fleet.HealthyClusters != 1 || fleet.Clusters != 3 ||
+		fleet.Replicas != 4 || fleet.AvailableReplicas != 3 {
+		t.Errorf("unexpected fleet health %+v", fleet)
+	}
+}
+
+func TestReconcileHealthRequeue(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		primary    = newTestClientset(1)
+		secondary  = newTestClientset(1)
+		replicator = newTestReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	)
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     primary,
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		Recorder: &record.FakeRecorder{},
+		Scheme:   scheme,
+	}
+
+	// The Pods of the new Deployments are not ready yet, so the health is read back again.
+	result, err := r.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != healthPollInterval {
+		t.Errorf("expected the health to be refreshed after %s, got %s", healthPollInterval, result.RequeueAfter)
+	}
+	var current plumberv1.Replicator
+	if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+		t.Fatal(err)
+	}
+	if current.Status.Health == nil || current.Status.Health.State != plumberv1.FleetHealthUnhealthy {
+		t.Errorf("expected the fleet to be unhealthy, got %+v", current.Status.Health)
+	}
+
+	markDeploymentAvailable(t, primary, "ns-0", "app-0")
+	markDeploymentAvailable(t, secondary, "ns-0", "app-0")
+	result, err = r.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != 0 {
+		t.Errorf("expected no requeue once the workload is healthy, got %s", result.RequeueAfter)
+	}
+	if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+		t.Fatal(err)
+	}
+	if current.Status.Health == nil || current.Status.Health.State != plumberv1.FleetHealthHealthy {
+		t.Errorf("expected the fleet to be healthy, got %+v", current.Status.Health)
+	}
+}
+
+func TestReconcileRevisions(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		primary    = newTestClientset(1)
+		secondary  = newTestClientset(1)
+		replicator = newTestReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	)
+	limit := int32(2)
+	replicator.Spec.RevisionHistoryLimit = &limit
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}, &plumberv1.ReplicationRun{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     primary,
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		Recorder: &record.FakeRecorder{},
+		Scheme:   scheme,
+	}
+
+	reconcile := func() plumberv1.Replicator {
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+		var current plumberv1.Replicator
+		if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+			t.Fatal(err)
+		}
+		return current
+	}
+	update := func(current plumberv1.Replicator, mutate func(spec *plumberv1.ReplicatorSpec)) {
+		mutate(&current.Spec)
+		if err := r.Update(ctx, &current); err != nil {
+			t.Fatal(err)
+		}
+	}
+	image := func() string {
+		deployment, err := secondary.AppsV1().Deployments("ns-0").Get(ctx, "app-0", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return deployment.Spec.Template.Spec.Containers[0].Image
+	}
+
+	// Every synced spec is recorded, and only two revisions are kept.
+	current := reconcile()
+	for _, tag := range []string{"v2", "v3"} {
+		update(current, func(spec *plumberv1.ReplicatorSpec) {
+			spec.DeploymentSpec.Template.Spec.Containers[0].WithImage("nginx:" + tag)
+		})
+		current = reconcile()
+	}
+	if current.Status.CurrentRevision != 3 || fmt.Sprint(current.Status.Revisions) != "[2 3]" {
+		t.Fatalf("unexpected revisions %d %v", current.Status.CurrentRevision, current.Status.Revisions)
+	}
+
+	// Rolling back re-applies the previous revision, which becomes the newest one.
+	update(current, func(spec *plumberv1.ReplicatorSpec) {
+		spec.RollbackTo = &plumberv1.RollbackConfig{}
+	})
+	current = reconcile()
+	if current.Spec.RollbackTo != nil || current.Spec.RevisionHistoryLimit == nil {
+		t.Fatalf("unexpected spec after rollback %+v", current.Spec)
+	}
+	current = reconcile()
+	if image() != "nginx:v2" {
+		t.Errorf("expected the previous revision to be applied, got %q", image())
+	}
+	if current.Status.CurrentRevision != 4 || fmt.Sprint(current.Status.Revisions) != "[3 4]" {
+		t.Fatalf("unexpected revisions %d %v", current.Status.CurrentRevision, current.Status.Revisions)
+	}
+
+	var revisions appsv1.ControllerRevisionList
+	if err := r.List(ctx, &revisions); err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions.Items) != 2 {
+		t.Errorf("expected 2 revisions, got %d", len(revisions.Items))
+	}
+
+	// Every sync is recorded, since the fake clientset does not track managed fields
+	// and every apply changes the resources. The rollback itself only changes the spec.
+	var runs plumberv1.ReplicationRunList
+	if err := r.List(ctx, &runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs.Items) != 4 {
+		t.Fatalf("expected 4 ReplicationRuns, got %d", len(runs.Items))
+	}
+	for _, run := range runs.Items {
+		if run.Spec.Replicator != replicator.GetName() || run.Status.Synced != plumberv1.SyncStateSynced {
+			t.Errorf("unexpected ReplicationRun %+v", run)
+		}
+		for _, c := range run.Status.Clusters {
+			if len(c.Resources) == 0 {
+				t.Errorf("expected changed resources on %s in %s", c.Cluster, run.GetName())
+			}
+		}
+	}
+}
+
+func TestReconcileReplicationRunFailures(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		secondary  = newTestClientset(1)
+		replicator = newTestReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+
+		mu      sync.Mutex
+		healthy bool
+	)
+	secondary.PrependReactor("patch", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if healthy {
+			return false, nil, nil
+		}
+		return true, nil, errors.New("admission webhook denied the request")
+	})
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}, &plumberv1.ReplicationRun{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     newTestClientset(1),
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		Recorder: &record.FakeRecorder{},
+		Scheme:   scheme,
+	}
+	runs := func() []plumberv1.ReplicationRun {
+		var runs plumberv1.ReplicationRunList
+		if err := r.List(ctx, &runs); err != nil {
+			t.Fatal(err)
+		}
+		return runs.Items
+	}
+
+	// Retries of the failing apply are recorded only once.
+	for i := 0; i < 3; i++ {
+		if _, err := r.Reconcile(ctx, req); err == nil {
+			t.Fatal("expected the replication to fail")
+		}
+	}
+	recorded := runs()
+	if len(recorded) != 1 {
+		t.Fatalf("expected 1 ReplicationRun, got %d", len(recorded))
+	}
+	var message string
+	for _, c := range recorded[0].Status.Clusters {
+		for _, resource := range c.Resources {
+			if c.Cluster == testSecondaryCluster && resource.Kind == "Deployment" {
+				message = resource.Message
+			}
+		}
+	}
+	if !strings.Contains(message, "admission webhook denied the request") {
+		t.Errorf("expected the apply error of the Deployment, got %+v", recorded[0].Status.Clusters)
+	}
+
+	// After a restart of the controller, the outcome is compared with the newest ReplicationRun.
+	r.lastRuns = nil
+	if _, err := r.Reconcile(ctx, req); err == nil {
+		t.Fatal("expected the replication to fail")
+	}
+	if n := len(runs()); n != 1 {
+		t.Errorf("expected the failing sync not to be recorded again after a restart, got %d", n)
+	}
+
+	// A different outcome is recorded.
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(runs()); n != 2 {
+		t.Errorf("expected the successful sync to be recorded, got %d ReplicationRuns", n)
+	}
+}
+
+func TestReconcileReplicationRunTTL(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		scheme  = newTestScheme(t)
+		started = time.Now().Truncate(time.Second)
+		run     = &plumberv1.ReplicationRun{ObjectMeta: metav1.ObjectMeta{Name: "replicator-0-abcde"}}
+		req     = ctrl.Request{NamespacedName: types.NamespacedName{Name: run.GetName()}}
+	)
+	run.Status.CompletionTime = metav1.NewTime(started)
+
+	r := &ReplicationRunReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(run).
+			WithStatusSubresource(&plumberv1.ReplicationRun{}).
+			Build(),
+		TTL: time.Hour,
+		now: func() time.Time { return started.Add(30 * time.Minute) },
+	}
+
+	result, err := r.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != 30*time.Minute {
+		t.Errorf("expected a requeue when the TTL expires, got %s", result.RequeueAfter)
+	}
+
+	r.now = func() time.Time { return started.Add(time.Hour) }
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, run); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the ReplicationRun to be deleted, got %v", err)
+	}
+}
+
+func TestReconcileEvents(t *testing.T) {
+	const (
+		unknownCluster = "unknown.kubernetes-admin3"
+		primaryCluster = "primary-cluster.primary-admin"
+	)
+
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		secondary  = newTestClientset(1)
+		recorder   = record.NewFakeRecorder(100)
+		replicator = newTestReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	)
+	replicator.Spec.TargetCluster = []string{testSecondaryCluster, unknownCluster, primaryCluster}
+	primary := &plumberv1.ClusterDetector{
+		ObjectMeta: metav1.ObjectMeta{Name: primaryCluster, Namespace: constants.Namespace},
+		Spec:       plumberv1.ClusterDetectorSpec{Primary: true},
+	}
+
+	for _, event := range []corev1.Event{
+		{
+			ObjectMeta:     metav1.ObjectMeta{Name: "app-0-5d8f7.1", Namespace: "ns-0"},
+			InvolvedObject: corev1.ObjectReference{Kind: "ReplicaSet", Name: "app-0-5d8f7"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "FailedCreate",
+			Message:        "exceeded quota",
+			LastTimestamp:  metav1.NewTime(time.Now().Truncate(time.Second)),
+		},
+		{
+			ObjectMeta:     metav1.ObjectMeta{Name: "other.1", Namespace: "ns-0"},
+			InvolvedObject: corev1.ObjectReference{Kind: "ReplicaSet", Name: "other"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "FailedCreate",
+			Message:        "not replicated",
+			LastTimestamp:  metav1.NewTime(time.Now().Truncate(time.Second)),
+		},
+	} {
+		event := event
+		if _, err := secondary.CoreV1().Events("ns-0").Create(ctx, &event, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator, primary).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     newTestClientset(1),
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		Recorder: recorder,
+		Scheme:   scheme,
+	}
+
+	events := func() map[string]bool {
+		recorded := make(map[string]bool)
+		for {
+			select {
+			case event := <-recorder.Events:
+				recorded[event] = true
+			default:
+				return recorded
+			}
+		}
+	}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	recorded := events()
+	for _, want := range []string{
+		"Normal NamespaceCreated Created namespace ns-0 on cluster " + testSecondaryCluster,
+		"Normal Applied Applied Deployment app-0 to cluster " + testSecondaryCluster,
+		"Warning UnknownCluster Skipped target cluster " + unknownCluster + ", no clientset could be created for it",
+		"Warning PrimaryTargetCluster Skipped target cluster " + primaryCluster + ", it is the primary cluster",
+		"Warning FailedCreate [" + testSecondaryCluster + "] ReplicaSet/app-0-5d8f7: exceeded quota",
+	} {
+		if !recorded[want] {
+			t.Errorf("expected event %q, got %v", want, recorded)
+		}
+	}
+	for event := range recorded {
+		if strings.Contains(event, "not replicated") {
+			t.Errorf("expected events of other objects not to be mirrored, got %q", event)
+		}
+	}
+
+	var current plumberv1.Replicator
+	if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+		t.Fatal(err)
+	}
+	if current.Status.SkippedClusters != 2 {
+		t.Errorf("expected the unknown and primary clusters to be skipped, got %+v", current.Status.Clusters)
+	}
+	for _, c := range current.Status.Clusters {
+		if c.Cluster == primaryCluster && c.Message != "the primary cluster cannot be a target cluster" {
+			t.Errorf("unexpected status of the primary cluster %+v", c)
+		}
+	}
+
+	// An event is mirrored only once.
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	for event := range events() {
+		if strings.HasPrefix(event, "Warning FailedCreate") {
+			t.Errorf("expected the event not to be mirrored again, got %q", event)
+		}
+	}
+}
+
+func TestMirrorEventsAfterRestart(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		secondary  = newTestClientset(1)
+		recorder   = record.NewFakeRecorder(100)
+		replicator = newTestReplicator(0)
+		now        = time.Now().Truncate(time.Second)
+	)
+	for name, timestamp := range map[string]time.Time{
+		// Mirrored by the previous instance of the controller.
+		"app-0-5d8f7.1": now.Add(-time.Hour),
+		"app-0-5d8f7.2": now,
+	} {
+		if _, err := secondary.CoreV1().Events("ns-0").Create(ctx, &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "ns-0"},
+			InvolvedObject: corev1.ObjectReference{Kind: "ReplicaSet", Name: "app-0-5d8f7"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "FailedCreate",
+			Message:        name,
+			LastTimestamp:  metav1.NewTime(timestamp),
+		}, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &ReplicatorReconciler{
+		Recorder:  recorder,
+		startTime: now.Add(-time.Minute),
+	}
+	r.mirrorEvents(
+		ctx,
+		ctrl.Log,
+		replicator,
+		[]plumberv1.ClusterSyncStatus{{Cluster: testSecondaryCluster, State: plumberv1.ClusterSyncStateApplied}},
+		map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+	)
+
+	var mirrored []string
+	for len(recorder.Events) > 0 {
+		mirrored = append(mirrored, <-recorder.Events)
+	}
+	if len(mirrored) != 1 || !strings.HasSuffix(mirrored[0], "app-0-5d8f7.2") {
+		t.Errorf("expected only the event after the start to be mirrored, got %v", mirrored)
+	}
+}
+
+func TestRequiredCapabilities(t *testing.T) {
+	replicator := newTestReplicator(0)
+	replicator.Spec.IngressSpec = &plumberv1.IngressSpecApplyConfiguration{}
+	replicator.Spec.RequiredAPIs = []plumberv1.RequiredAPI{{GroupVersion: "monitoring.coreos.com/v1"}}
+	replicator.Spec.DeploymentSpec.Template.Spec.WithVolumes(
+		corev1apply.Volume().WithName("cache").WithEphemeral(corev1apply.EphemeralVolumeSource().
+			WithVolumeClaimTemplate(corev1apply.PersistentVolumeClaimTemplate().
+				WithSpec(corev1apply.PersistentVolumeClaimSpec().WithStorageClassName("fast")))),
+		corev1apply.Volume().WithName("data").WithEphemeral(corev1apply.EphemeralVolumeSource().
+			WithVolumeClaimTemplate(corev1apply.PersistentVolumeClaimTemplate().
+				WithSpec(corev1apply.PersistentVolumeClaimSpec().WithStorageClassName("fast")))),
+	)
+
+	var names []string
+	for _, c := range requiredCapabilities(*replicator) {
+		names = append(names, c.String())
+	}
+	expected := "IngressClass nginx, API monitoring.coreos.com/v1, StorageClass fast"
+	if got := strings.Join(names, ", "); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	if required := requiredCapabilities(*newTestReplicator(0)); len(required) != 0 {
+		t.Errorf("expected no capabilities for a Deployment and a ConfigMap, got %v", required)
+	}
+}
+
+func TestMissingIngressClass(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		required = []capability{{kind: capabilityIngressClass, name: constants.IngressClassName}}
+		v1       = apiVersions{kindIngress: networkingv1.SchemeGroupVersion}
+		v1beta1  = apiVersions{kindIngress: networkingv1beta1.SchemeGroupVersion}
+	)
+
+	tests := []struct {
+		name      string
+		versions  apiVersions
+		resources []metav1.APIResource
+		objects   []runtime.Object
+		missing   bool
+	}{
+		{
+			name:     "v1",
+			versions: v1,
+			objects:  []runtime.Object{&networkingv1.IngressClass{ObjectMeta: metav1.ObjectMeta{Name: constants.IngressClassName}}},
+		},
+		{name: "v1 missing", versions: v1, missing: true},
+		{
+			name:      "v1beta1",
+			versions:  v1beta1,
+			resources: []metav1.APIResource{{Name: "ingresses"}, {Name: "ingressclasses"}},
+			objects:   []runtime.Object{&networkingv1beta1.IngressClass{ObjectMeta: metav1.ObjectMeta{Name: constants.IngressClassName}}},
+		},
+		{
+			name:      "v1beta1 missing",
+			versions:  v1beta1,
+			resources: []metav1.APIResource{{Name: "ingresses"}, {Name: "ingressclasses"}},
+			missing:   true,
+		},
+		// Before v1.18 there is no IngressClass API to check.
+		{name: "v1beta1 without IngressClasses", versions: v1beta1, resources: []metav1.APIResource{{Name: "ingresses"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientSet := k8sfake.NewSimpleClientset(tt.objects...)
+			clientSet.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{{
+				GroupVersion: networkingv1beta1.SchemeGroupVersion.String(),
+				APIResources: tt.resources,
+			}}
+
+			missing, err := missingCapabilities(ctx, clientSet, required, tt.versions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(missing) > 0) != tt.missing {
+				t.Errorf("expected missing %v, got %v", tt.missing, missing)
+			}
+		})
+	}
+}
+
+func TestReconcileIncompatibleCluster(t *testing.T) {
+	const incompatibleCluster = "incompatible.kubernetes-admin3"
+
+	var (
+		ctx          = context.Background()
+		scheme       = newTestScheme(t)
+		replicator   = newTestReplicator(0)
+		compatible   = newTestClientset(1)
+		incompatible = newTestClientset(1)
+		monitoringV1 = &metav1.APIResourceList{
+			GroupVersion: "monitoring.coreos.com/v1",
+			APIResources: []metav1.APIResource{{Name: "servicemonitors"}},
+		}
+	)
+	replicator.Spec.TargetCluster = []string{testSecondaryCluster, incompatibleCluster}
+	replicator.Spec.RequiredAPIs = []plumberv1.RequiredAPI{
+		{GroupVersion: "monitoring.coreos.com/v1", Resource: "servicemonitors"},
+	}
+	replicator.Spec.DeploymentSpec.Template.Spec.WithVolumes(
+		corev1apply.Volume().WithName("cache").WithEphemeral(corev1apply.EphemeralVolumeSource().
+			WithVolumeClaimTemplate(corev1apply.PersistentVolumeClaimTemplate().
+				WithSpec(corev1apply.PersistentVolumeClaimSpec().WithStorageClassName("fast")))),
+	)
+	compatible.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{monitoringV1}
+	if _, err := compatible.StorageV1().StorageClasses().Create(
+		ctx,
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}},
+		metav1.CreateOptions{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// The workload is healthy, so the Replicator is not requeued to read back its health.
+	primary := newTestClientset(1)
+	markDeploymentAvailable(t, primary, "ns-0", "app-0")
+	markDeploymentAvailable(t, compatible, "ns-0", "app-0")
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary: primary,
+			secondaries: map[string]kubernetes.Interface{
+				testSecondaryCluster: compatible,
+				incompatibleCluster:  incompatible,
+			},
+		},
+		Recorder: &record.FakeRecorder{},
+		Scheme:   scheme,
+	}
+
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != capabilityRecheckInterval {
+		t.Errorf("expected the incompatible cluster to be checked again after %s, got %s",
+			capabilityRecheckInterval, result.RequeueAfter)
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(replicator), replicator); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range replicator.Status.Clusters {
+		switch c.Cluster {
+		case incompatibleCluster:
+			expected := "incompatible cluster, missing API monitoring.coreos.com/v1/servicemonitors, StorageClass fast"
+			if c.State != plumberv1.ClusterSyncStateSkipped || c.Message != expected {
+				t.Errorf("expected the cluster to be skipped with %q, got %+v", expected, c)
+			}
+		default:
+			if c.State != plumberv1.ClusterSyncStateApplied {
+				t.Errorf("expected %s to be applied, got %+v", c.Cluster, c)
+			}
+		}
+	}
+	if replicator.Status.SkippedClusters != 1 {
+		t.Errorf("expected 1 skipped cluster, got %d", replicator.Status.SkippedClusters)
+	}
+
+	// The discovery results of the incompatible cluster are kept until the recheck interval has passed,
+	// and its clientset is never discarded.
+	provider := r.Clientsets.(*fakeClientsetProvider)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.invalidatedDiscovery) != 0 {
+		t.Errorf("expected the discovery results to be kept, got %v", provider.invalidatedDiscovery)
+	}
+	key := replicatorClusterKey(replicator.GetUID(), incompatibleCluster)
+	r.incompatible[key] = r.incompatible[key].Add(-capabilityRecheckInterval)
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if d := provider.invalidatedDiscovery; len(d) != 1 || d[0] != incompatibleCluster {
+		t.Errorf("expected the APIs of %s to be discovered again, got %v", incompatibleCluster, d)
+	}
+	if len(provider.invalidated) != 0 {
+		t.Errorf("expected the clientsets to be kept, got %v", provider.invalidated)
+	}
+
+	// Nothing was applied to the incompatible cluster.
+	for _, action := range incompatible.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("unexpected apply to the incompatible cluster: %v", action)
+		}
+	}
+}
+
+func TestIngressToV1beta1(t *testing.T) {
+	ingress := networkv1apply.Ingress("ing-0", "ns-0").
+		WithSpec(networkv1apply.IngressSpec().
+			WithIngressClassName("nginx").
+			WithTLS(networkv1apply.IngressTLS().WithHosts("nginx.example.com").WithSecretName("tls")).
+			WithRules(networkv1apply.IngressRule().
+				WithHost("nginx.example.com").
+				WithHTTP(networkv1apply.HTTPIngressRuleValue().
+					WithPaths(
+						networkv1apply.HTTPIngressPath().
+							WithPath("/").
+							WithPathType(networkingv1.PathTypePrefix).
+							WithBackend(networkv1apply.IngressBackend().
+								WithService(networkv1apply.IngressServiceBackend().
+									WithName("svc-0").
+									WithPort(networkv1apply.ServiceBackendPort().WithNumber(80)))),
+						networkv1apply.HTTPIngressPath().
+							WithPath("/metrics").
+							WithBackend(networkv1apply.IngressBackend().
+								WithService(networkv1apply.IngressServiceBackend().
+									WithName("svc-0").
+									WithPort(networkv1apply.ServiceBackendPort().WithName("metrics"))))))))
+
+	converted, err := ingressToV1beta1(ingress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *converted.APIVersion != "networking.k8s.io/v1beta1" || *converted.Name != "ing-0" || *converted.Namespace != "ns-0" {
+		t.Errorf("unexpected metadata %v %v", converted.TypeMetaApplyConfiguration, converted.ObjectMetaApplyConfiguration)
+	}
+	if *converted.Spec.IngressClassName != "nginx" || converted.Spec.TLS[0].Hosts[0] != "nginx.example.com" {
+		t.Errorf("unexpected spec %+v", converted.Spec)
+	}
+	paths := converted.Spec.Rules[0].HTTP.Paths
+	if *paths[0].PathType != networkingv1beta1.PathTypePrefix ||
+		*paths[0].Backend.ServiceName != "svc-0" || paths[0].Backend.ServicePort.IntValue() != 80 {
+		t.Errorf("unexpected path %+v", paths[0])
+	}
+	if paths[1].PathType != nil || paths[1].Backend.ServicePort.String() != "metrics" {
+		t.Errorf("unexpected path %+v", paths[1])
+	}
+
+	// A Service backend without a port has no equivalent in v1beta1.
+	ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port = nil
+	if _, err := ingressToV1beta1(ingress); err == nil {
+		t.Error("expected the conversion to fail")
+	}
+}
+
+func TestNegotiateVersions(t *testing.T) {
+	var (
+		v1 = &metav1.APIResourceList{
+			GroupVersion: "networking.k8s.io/v1",
+			APIResources: []metav1.APIResource{{Name: "ingresses"}, {Name: "ingressclasses"}},
+		}
+		v1beta1 = &metav1.APIResourceList{
+			GroupVersion: "networking.k8s.io/v1beta1",
+			APIResources: []metav1.APIResource{{Name: "ingresses"}},
+		}
+	)
+
+	tests := []struct {
+		name      string
+		resources []*metav1.APIResourceList
+		expected  string
+	}{
+		{name: "v1.25", resources: []*metav1.APIResourceList{v1}, expected: "networking.k8s.io/v1"},
+		{name: "v1.20", resources: []*metav1.APIResourceList{v1, v1beta1}, expected: "networking.k8s.io/v1"},
+		{name: "v1.18", resources: []*metav1.APIResourceList{v1beta1}, expected: "networking.k8s.io/v1beta1"},
+		{name: "v1.13", resources: nil},
+	}
+	for _, tt := range tests {
+		for _, cached := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s cached=%v", tt.name, cached), func(t *testing.T) {
+				var clientSet kubernetes.Interface = k8sfake.NewSimpleClientset()
+				clientSet.Discovery().(*fakediscovery.FakeDiscovery).Resources = tt.resources
+				// The clientsets of the ClusterRegistry cache the discovery results.
+				if cached {
+					clientSet = &cachedDiscoveryClientset{
+						Interface: clientSet,
+						discovery: memory.NewMemCacheClient(clientSet.Discovery()),
+					}
+				}
+
+				versions, err := negotiateVersions(context.Background(), clientSet, []string{kindIngress})
+				if tt.expected == "" {
+					if _, ok := err.(*unsupportedVersionError); !ok {
+						t.Fatalf("expected the Ingress to be unsupported, got %v", err)
+					}
+					if !strings.Contains(err.Error(), "unsupported on this cluster version") {
+						t.Errorf("unexpected message %q", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := versions.of(kindIngress).String(); got != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, got)
+				}
+			})
+		}
+	}
+
+	// A cluster that does not answer is given up on when the context is done.
+	clientSet := k8sfake.NewSimpleClientset()
+	unblock := make(chan struct{})
+	defer close(unblock)
+	clientSet.PrependReactor("get", "resource", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		<-unblock
+		return false, nil, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := negotiateVersions(ctx, clientSet, []string{kindIngress}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the discovery to time out, got %v", err)
+	}
+}
+
+type cachedDiscoveryClientset struct {
+	kubernetes.Interface
+	discovery discovery.CachedDiscoveryInterface
+}
+
+func (c *cachedDiscoveryClientset) Discovery() discovery.DiscoveryInterface {
+	return c.discovery
+}
+
+func TestReconcileIngressV1beta1(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		replicator = newTestReplicator(0)
+		primary    = newTestClientset(1)
+		secondary  = newTestClientset(1)
+	)
+	replicator.Spec.IngressName = "ing-0"
+	replicator.Spec.IngressSpec = (*plumberv1.IngressSpecApplyConfiguration)(networkv1apply.IngressSpec().
+		WithRules(networkv1apply.IngressRule().
+			WithHost("nginx.example.com").
+			WithHTTP(networkv1apply.HTTPIngressRuleValue().
+				WithPaths(networkv1apply.HTTPIngressPath().
+					WithPath("/").
+					WithPathType(networkingv1.PathTypePrefix).
+					WithBackend(networkv1apply.IngressBackend().
+						WithService(networkv1apply.IngressServiceBackend().
+							WithName("svc-0").
+							WithPort(networkv1apply.ServiceBackendPort().WithNumber(80))))))))
+
+	if _, err := primary.NetworkingV1().Ingresses("ns-0").Create(
+		ctx,
+		&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "ing-0", Namespace: "ns-0"}},
+		metav1.CreateOptions{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// The secondary cluster is v1.18, it serves the Ingress and the IngressClass only as v1beta1.
+	secondary.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{{
+		GroupVersion: "networking.k8s.io/v1beta1",
+		APIResources: []metav1.APIResource{{Name: "ingresses"}, {Name: "ingressclasses"}},
+	}}
+	if _, err := secondary.NetworkingV1beta1().Ingresses("ns-0").Create(
+		ctx,
+		&networkingv1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "ing-0", Namespace: "ns-0"}},
+		metav1.CreateOptions{},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secondary.NetworkingV1beta1().IngressClasses().Create(
+		ctx,
+		&networkingv1beta1.IngressClass{ObjectMeta: metav1.ObjectMeta{Name: constants.IngressClassName}},
+		metav1.CreateOptions{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     primary,
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		Recorder: &record.FakeRecorder{},
+		Scheme:   scheme,
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var applied bool
+	for _, action := range secondary.Actions() {
+		if action.GetVerb() != "patch" || action.GetResource().Resource != "ingresses" {
+			continue
+		}
+		if v := action.GetResource().Version; v != "v1beta1" {
+			t.Errorf("expected the Ingress to be applied as v1beta1, got %s", v)
+		}
+		applied = true
+	}
+	if !applied {
+		t.Error("expected the Ingress to be applied to the secondary cluster")
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(replicator), replicator); err != nil {
+		t.Fatal(err)
+	}
+	if replicator.Status.Synced != plumberv1.SyncStateSynced {
+		t.Errorf("expected Synced, got %q: %+v", replicator.Status.Synced, replicator.Status.Clusters)
+	}
+}
+
+func newDeletedReplicator(i int) *plumberv1.Replicator {
+	replicator := newTestReplicator(i)
+	deletionTimestamp := metav1.NewTime(time.Now().Truncate(time.Second))
+	replicator.SetDeletionTimestamp(&deletionTimestamp)
+	replicator.SetFinalizers([]string{constants.FinalizerName})
+
+	return replicator
+}
+
+func deleteActions(clientSet *k8sfake.Clientset) int {
+	var n int
+	for _, action := range clientSet.Actions() {
+		if action.GetVerb() == "delete" {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestFinalizeRetriesFailedClusters(t *testing.T) {
+	const failingCluster = "failing.kubernetes-admin3"
+
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		secondary  = newTestClientset(1)
+		failing    = newTestClientset(1)
+		replicator = newDeletedReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+
+		mu      sync.Mutex
+		healthy bool
+	)
+	replicator.Spec.TargetCluster = []string{testSecondaryCluster, failingCluster}
+	failing.PrependReactor("delete", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if healthy {
+			return false, nil, nil
+		}
+		return true, nil, errors.New("connection refused")
+	})
+
+	// The reconciler has no Recorder, so events must be skipped.
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary: newTestClientset(1),
+			secondaries: map[string]kubernetes.Interface{
+				testSecondaryCluster: secondary,
+				failingCluster:       failing,
+			},
+		},
+		Scheme: scheme,
+	}
+
+	result, err := r.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != cleanupBaseBackoff {
+		t.Errorf("expected requeue after %s, got %s", cleanupBaseBackoff, result.RequeueAfter)
+	}
+
+	var current plumberv1.Replicator
+	if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+		t.Fatal(err)
+	}
+	if !controllerutil.ContainsFinalizer(&current, constants.FinalizerName) {
+		t.Fatal("expected the finalizer to be kept while a cleanup is pending")
+	}
+	pending := current.Status.PendingCleanups
+	if len(pending) != 1 || pending[0].Cluster != failingCluster {
+		t.Fatalf("expected only %s to be pending, got %+v", failingCluster, pending)
+	}
+	if pending[0].Attempts != 1 || pending[0].LastAttemptTime == nil ||
+		!strings.Contains(pending[0].LastError, "connection refused") {
+		t.Errorf("unexpected pending cleanup %+v", pending[0])
+	}
+
+	// The cleaned up cluster is not touched again,
+	// and the failed cluster is not retried before its backoff expires.
+	secondaryDeletes, failingDeletes := deleteActions(secondary), deleteActions(failing)
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if n := deleteActions(secondary); n != secondaryDeletes {
+		t.Errorf("expected the cleaned up cluster not to be retried, got %d deletes", n-secondaryDeletes)
+	}
+	if n := deleteActions(failing); n != failingDeletes {
+		t.Errorf("expected no retry before the backoff expires, got %d deletes", n-failingDeletes)
+	}
+
+	// Once the backoff expires and the cluster recovers, the finalizer is removed.
+	if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+		t.Fatal(err)
+	}
+	past := metav1.NewTime(time.Now().Add(-cleanupBaseBackoff))
+	current.Status.PendingCleanups[0].LastAttemptTime = &past
+	if err := r.Status().Update(ctx, &current); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if n := deleteActions(failing); n == failingDeletes {
+		t.Error("expected the failed cluster to be retried")
+	}
+	if err := r.Get(ctx, req.NamespacedName, &current); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the replicator to be deleted, got %v", err)
+	}
+}
+
+func TestFinalizeSkipsPrimaryTargets(t *testing.T) {
+	const markedPrimary = "primary-cluster.primary-admin"
+
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		secondary  = newTestClientset(1)
+		replicator = newDeletedReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+		detector   = &plumberv1.ClusterDetector{
+			ObjectMeta: metav1.ObjectMeta{Name: markedPrimary, Namespace: constants.Namespace},
+			Spec:       plumberv1.ClusterDetectorSpec{Primary: true},
+		}
+	)
+	// Neither primary cluster has a secondary clientset, and no cleanup timeout is set,
+	// so pending primary clusters would block the deletion forever.
+	replicator.Spec.TargetCluster = []string{testSecondaryCluster, testPrimaryCluster, markedPrimary}
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator, detector).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     newTestClientset(1),
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		Scheme: scheme,
+	}
+
+	result, err := r.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != 0 {
+		t.Errorf("expected no retry, got %s", result.RequeueAfter)
+	}
+
+	var current plumberv1.Replicator
+	if err := r.Get(ctx, req.NamespacedName, &current); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the finalizer to be removed, got %v with %+v", err, current.Status.PendingCleanups)
+	}
+	if deleteActions(secondary) == 0 {
+		t.Error("expected the secondary cluster to be cleaned up")
+	}
+}
+
+func TestFinalizeClusterTimeout(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		replicator = newDeletedReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	)
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     newTestClientset(1),
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: newHungClientset(t, nil, nil)},
+		},
+		ClusterTimeout: 100 * time.Millisecond,
+		Scheme:         scheme,
+	}
+
+	start := time.Now()
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the cleanup of the hung cluster to be cut off, took %s", elapsed)
+	}
+
+	var current plumberv1.Replicator
+	if err := r.Get(ctx, req.NamespacedName, &current); err != nil {
+		t.Fatal(err)
+	}
+	pending := current.Status.PendingCleanups
+	if len(pending) != 1 || !strings.Contains(pending[0].LastError, context.DeadlineExceeded.Error()) {
+		t.Errorf("expected the cleanup to time out, got %+v", pending)
+	}
+}
+
+func TestFinalizeCleanupTimeout(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		secondary  = newTestClientset(1)
+		recorder   = record.NewFakeRecorder(100)
+		replicator = newDeletedReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	)
+	deletionTimestamp := metav1.NewTime(time.Now().Add(-2 * time.Minute).Truncate(time.Second))
+	replicator.SetDeletionTimestamp(&deletionTimestamp)
+	replicator.Spec.CleanupTimeout = &metav1.Duration{Duration: time.Minute}
+	secondary.PrependReactor("delete", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     newTestClientset(1),
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		Recorder: recorder,
+		Scheme:   scheme,
+	}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	var current plumberv1.Replicator
+	if err := r.Get(ctx, req.NamespacedName, &current); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the finalizer to be removed after the cleanup timeout, got %v", err)
+	}
+
+	var abandoned bool
+	for len(recorder.Events) > 0 {
+		event := <-recorder.Events
+		if strings.HasPrefix(event, "Warning CleanupAbandoned") && strings.Contains(event, testSecondaryCluster) {
+			abandoned = true
+		}
+	}
+	if !abandoned {
+		t.Error("expected a CleanupAbandoned event")
+	}
+}
+
+func TestFinalizeForceDelete(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		scheme     = newTestScheme(t)
+		secondary  = newTestClientset(1)
+		recorder   = record.NewFakeRecorder(100)
+		replicator = newDeletedReplicator(0)
+		req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+	)
+	replicator.SetAnnotations(map[string]string{constants.ForceDeleteAnnotation: "true"})
+
+	r := &ReplicatorReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(replicator).
+			WithStatusSubresource(&plumberv1.Replicator{}).
+			Build(),
+		Clientsets: &fakeClientsetProvider{
+			primary:     newTestClientset(1),
+			secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+		},
+		Recorder: recorder,
+		Scheme:   scheme,
+	}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	var current plumberv1.Replicator
+	if err := r.Get(ctx, req.NamespacedName, &current); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the finalizer to be removed, got %v", err)
+	}
+	if n := deleteActions(secondary); n != 0 {
+		t.Errorf("expected the secondary cluster not to be cleaned up, got %d deletes", n)
+	}
+
+	var forced bool
+	for len(recorder.Events) > 0 {
+		if strings.HasPrefix(<-recorder.Events, "Warning ForceDeleted") {
+			forced = true
+		}
+	}
+	if !forced {
+		t.Error("expected a ForceDeleted event")
+	}
+}
+
+// Return a clientset with the replicated resources of newTestReplicator(0) as plumber leaves them,
+// labelled and, on the primary cluster, owned by the Replicator.
+func newReplicatedClientset(owned bool) *k8sfake.Clientset {
+	objectMeta := func(name, namespace string) metav1.ObjectMeta {
+		m := metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{constants.ReplicatorLabel: "replicator-0", "app": "nginx"},
+		}
+		if owned {
+			m.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: plumberv1.GroupVersion.String(),
+				Kind:       "Replicator",
+				Name:       "replicator-0",
+				UID:        "uid-0",
+			}}
+		}
+		return m
+	}
+
+	return k8sfake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: objectMeta("ns-0", "")},
+		&appsv1.Deployment{ObjectMeta: objectMeta("app-0", "ns-0")},
+		&corev1.ConfigMap{ObjectMeta: objectMeta("cm-0", "ns-0")},
+	)
+}
+
+func TestDeletionPolicyFor(t *testing.T) {
+	replicator := newTestReplicator(0)
+	if policy := deletionPolicyFor(*replicator, testSecondaryCluster); policy != plumberv1.DeletionPolicyDelete {
+		t.Errorf("expected Delete by default, got %s", policy)
+	}
+
+	replicator.Spec.DeletionPolicy = plumberv1.DeletionPolicyRetain
+	replicator.Spec.ClusterDeletionPolicies = []plumberv1.ClusterDeletionPolicy{
+		{Cluster: testSecondaryCluster, Policy: plumberv1.DeletionPolicyOrphan},
+	}
+	if policy := deletionPolicyFor(*replicator, testSecondaryCluster); policy != plumberv1.DeletionPolicyOrphan {
+		t.Errorf("expected the cluster policy to override the global one, got %s", policy)
+	}
+	if policy := deletionPolicyFor(*replicator, testPrimaryCluster); policy != plumberv1.DeletionPolicyRetain {
+		t.Errorf("expected the global policy for other clusters, got %s", policy)
+	}
+}
+
+func TestFinalizeDeletionPolicies(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    plumberv1.DeletionPolicy
+		overrides []plumberv1.ClusterDeletionPolicy
+		primary   plumberv1.DeletionPolicy
+		secondary plumberv1.DeletionPolicy
+	}{
+		{
+			name:      "default",
+			primary:   plumberv1.DeletionPolicyDelete,
+			secondary: plumberv1.DeletionPolicyDelete,
+		},
+		{
+			name:      "orphan",
+			policy:    plumberv1.DeletionPolicyOrphan,
+			primary:   plumberv1.DeletionPolicyOrphan,
+			secondary: plumberv1.DeletionPolicyOrphan,
+		},
+		{
+			name:      "retain",
+			policy:    plumberv1.DeletionPolicyRetain,
+			primary:   plumberv1.DeletionPolicyRetain,
+			secondary: plumberv1.DeletionPolicyRetain,
+		},
+		{
+			name:   "cluster override",
+			policy: plumberv1.DeletionPolicyRetain,
+			overrides: []plumberv1.ClusterDeletionPolicy{
+				{Cluster: testSecondaryCluster, Policy: plumberv1.DeletionPolicyDelete},
+			},
+			primary:   plumberv1.DeletionPolicyRetain,
+			secondary: plumberv1.DeletionPolicyDelete,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				ctx        = context.Background()
+				scheme     = newTestScheme(t)
+				primary    = newReplicatedClientset(true)
+				secondary  = newReplicatedClientset(false)
+				replicator = newDeletedReplicator(0)
+				req        = ctrl.Request{NamespacedName: types.NamespacedName{Name: replicator.GetName()}}
+			)
+			replicator.Spec.DeletionPolicy = tt.policy
+			replicator.Spec.ClusterDeletionPolicies = tt.overrides
+
+			r := &ReplicatorReconciler{
+				Client: fake.NewClientBuilder().
+					WithScheme(scheme).
+					WithObjects(replicator).
+					WithStatusSubresource(&plumberv1.Replicator{}).
+					Build(),
+				Clientsets: &fakeClientsetProvider{
+					primary:     primary,
+					secondaries: map[string]kubernetes.Interface{testSecondaryCluster: secondary},
+				},
+				Scheme: scheme,
+			}
+
+			if _, err := r.Reconcile(ctx, req); err != nil {
+				t.Fatal(err)
+			}
+			var current plumberv1.Replicator
+			if err := r.Get(ctx, req.NamespacedName, &current); !apierrors.IsNotFound(err) {
+				t.Errorf("expected the finalizer to be removed, got %v", err)
+			}
+
+			// Retain does not touch the secondary cluster at all.
+			if tt.secondary == plumberv1.DeletionPolicyRetain && len(secondary.Actions()) != 0 {
+				t.Errorf("expected no calls to the secondary cluster, got %v", secondary.Actions())
+			}
+
+			for cluster, c := range map[string]struct {
+				clientSet *k8sfake.Clientset
+				policy    plumberv1.DeletionPolicy
+			}{
+				testPrimaryCluster:   {primary, tt.primary},
+				testSecondaryCluster: {secondary, tt.secondary},
+			} {
+				var objects []metav1.Object
+				namespace, err := c.clientSet.CoreV1().Namespaces().Get(ctx, "ns-0", metav1.GetOptions{})
+				if c.policy == plumberv1.DeletionPolicyDelete {
+					if !apierrors.IsNotFound(err) {
+						t.Errorf("%s: expected the namespace to be deleted, got %v", cluster, err)
+					}
+				} else if err != nil {
+					t.Errorf("%s: expected the namespace to be kept, got %v", cluster, err)
+				} else {
+					objects = append(objects, namespace)
+				}
+
+				// The resources of the primary cluster are deleted by the garbage collector.
+				if cluster == testSecondaryCluster || c.policy != plumberv1.DeletionPolicyDelete {
+					deployment, err := c.clientSet.AppsV1().Deployments("ns-0").Get(ctx, "app-0", metav1.GetOptions{})
+					switch {
+					case c.policy == plumberv1.DeletionPolicyDelete:
+						if !apierrors.IsNotFound(err) {
+							t.Errorf("%s: expected the Deployment to be deleted, got %v", cluster, err)
+						}
+					case err != nil:
+						t.Errorf("%s: expected the Deployment to be kept, got %v", cluster, err)
+					default:
+						objects = append(objects, deployment)
+					}
+				}
+
+				for _, obj := range objects {
+					if len(obj.GetOwnerReferences()) != 0 {
+						t.Errorf("%s: expected the owner references of %s to be removed, got %v",
+							cluster, obj.GetName(), obj.GetOwnerReferences())
+					}
+					_, labelled := obj.GetLabels()[constants.ReplicatorLabel]
+					if labelled != (c.policy == plumberv1.DeletionPolicyRetain) {
+						t.Errorf("%s: unexpected labels of %s with %s policy: %v",
+							cluster, obj.GetName(), c.policy, obj.GetLabels())
+					}
+					if obj.GetLabels()["app"] != "nginx" {
+						t.Errorf("%s: expected the labels of the user to be kept, got %v", cluster, obj.GetLabels())
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// Diffs longer than this are truncated, so that the status stays well below the size limit of an object.
+const maxDryRunDiffLength = 4096
+
+func (s *syncStatus) recordDryRun(result plumberv1.DryRunResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dryRun = append(s.dryRun, result)
+}
+
+// Return the recorded dry run results sorted by cluster.
+func (s *syncStatus) sortedDryRun() []plumberv1.DryRunResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := append([]plumberv1.DryRunResult(nil), s.dryRun...)
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Cluster < results[j].Cluster
+	})
+
+	return results
+}
+
+// Preview the changes of the Replicator on all clusters.
+// Every apply is sent with DryRun All, so nothing is mutated.
+// All clusters are previewed even if some of them reject the apply.
+func (r *ReplicatorReconciler) Preview(
+	ctx context.Context,
+	log logr.Logger,
+	req ctrl.Request,
+	replicator plumberv1.Replicator,
+	primaryClientSet map[string]kubernetes.Interface,
+	secondaryClientsets map[string]kubernetes.Interface,
+) (ReplicateResult, error) {
+	return r.replicate(ctx, log, req, replicator, primaryClientSet, secondaryClientsets, true)
+}
+
+// Return the difference between two apply configurations as a diff of their JSON representation.
+func diffApplyConfigurations(before, after interface{}) (string, error) {
+	var b, a map[string]interface{}
+	for _, v := range []struct {
+		in  interface{}
+		out *map[string]interface{}
+	}{{before, &b}, {after, &a}} {
+		raw, err := json.Marshal(v.in)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode apply configuration: %w", err)
+		}
+		if err := json.Unmarshal(raw, v.out); err != nil {
+			return "", fmt.Errorf("failed to decode apply configuration: %w", err)
+		}
+	}
+
+	diff := cmp.Diff(b, a)
+	if len(diff) > maxDryRunDiffLength {
+		diff = diff[:maxDryRunDiffLength] + "\n... (truncated)"
+	}
+
+	return diff, nil
+}
+
+// Send the apply with DryRun All and record what it would do to the resource.
+// The fields managed by plumber before the apply are compared with those in the object returned by the dry run.
+func previewApply[A any, O any](
+	applyRuntime ReplicateRuntime,
+	fieldMgr string,
+	s plumberv1.PerResourceApplyStatus,
+	exists bool,
+	curr A,
+	next A,
+	apply func(opts metav1.ApplyOptions) (O, error),
+	extract func(applied O) (A, error),
+) error {
+	result := plumberv1.DryRunResult{
+		Cluster: s.Cluster,
+		Kind:    s.Kind,
+		Name:    s.Name,
+		Action:  plumberv1.DryRunActionUnchanged,
+	}
+	defer func() { applyRuntime.SyncStatus.recordDryRun(result) }()
+
+	if exists && equality.Semantic.DeepEqual(curr, next) {
+		return nil
+	}
+
+	applied, err := apply(metav1.ApplyOptions{
+		FieldManager: fieldMgr,
+		Force:        true,
+		DryRun:       []string{metav1.DryRunAll},
+	})
+	if err != nil {
+		// Namespaced resources cannot be validated before their namespace exists.
+		if !exists && errors.IsNotFound(err) {
+			result.Action = plumberv1.DryRunActionCreate
+			result.Message = "not validated, the namespace does not exist yet"
+			return nil
+		}
+
+		result.Action = plumberv1.DryRunActionRejected
+		result.Message = err.Error()
+		return fmt.Errorf("dry run of %s %s rejected: %w", s.Kind, s.Name, err)
+	}
+
+	if !exists {
+		result.Action = plumberv1.DryRunActionCreate
+		return nil
+	}
+
+	after, err := extract(applied)
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", s.Kind, err)
+	}
+	diff, err := diffApplyConfigurations(curr, after)
+	if err != nil {
+		return err
+	}
+	if diff != "" {
+		result.Action = plumberv1.DryRunActionChange
+		result.Diff = diff
+	}
+
+	return nil
+}
+
+// Record whether the replication namespace would be created.
+func previewNamespace(applyRuntime ReplicateRuntime) {
+	result := plumberv1.DryRunResult{
+		Cluster: applyRuntime.Cluster,
+		Kind:    "Namespace",
+		Name:    applyRuntime.Replicator.Spec.ReplicationNamespace,
+		Action:  plumberv1.DryRunActionUnchanged,
+	}
+
+	if _, err := applyRuntime.ClientSet.CoreV1().Namespaces().Get(
+		applyRuntime.Context,
+		applyRuntime.Replicator.Spec.ReplicationNamespace,
+		metav1.GetOptions{},
+	); err != nil {
+		if errors.IsNotFound(err) {
+			result.Action = plumberv1.DryRunActionCreate
+		} else {
+			result.Action = plumberv1.DryRunActionRejected
+			result.Message = err.Error()
+		}
+	}
+
+	applyRuntime.SyncStatus.recordDryRun(result)
+}
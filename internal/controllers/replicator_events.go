@@ -0,0 +1,165 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// Reasons of the Warning events on secondary clusters that are mirrored onto the Replicator.
+// They report why the replicated workload does not run, e.g. FailedCreate of the ReplicaSet
+// when a quota or an admission webhook rejects the pods.
+var mirroredEventReasons = map[string]bool{
+	"FailedCreate":     true,
+	"FailedScheduling": true,
+	"FailedMount":      true,
+	"Failed":           true,
+	"BackOff":          true,
+}
+
+// Key of the state kept per cluster of a Replicator.
+func replicatorClusterKey(uid types.UID, cluster string) string {
+	return fmt.Sprintf("%s/%s", uid, cluster)
+}
+
+// Return the time an event last occurred.
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+
+	return event.GetCreationTimestamp().Time
+}
+
+// Report whether the event is about an object created for the Replicator.
+// Pods and ReplicaSets of the Deployment are named after it.
+func isReplicatedObject(replicator plumberv1.Replicator, object corev1.ObjectReference) bool {
+	switch object.Name {
+	case replicator.Spec.DeploymentName, replicator.Spec.ServiceName, replicator.Spec.IngressName:
+		return len(object.Name) > 0
+	}
+
+	return len(replicator.Spec.DeploymentName) > 0 &&
+		strings.HasPrefix(object.Name, replicator.Spec.DeploymentName+"-")
+}
+
+// Mirror the Warning events of the replicated objects on the secondary clusters onto the Replicator.
+// Only events that occurred after those mirrored by the previous reconcile are recorded,
+// so each event is mirrored once per occurrence.
+// Before the first reconcile after a restart, only events that occurred after the controller started are recorded.
+func (r *ReplicatorReconciler) mirrorEvents(
+	ctx context.Context,
+	log logr.Logger,
+	replicator *plumberv1.Replicator,
+	clusters []plumberv1.ClusterSyncStatus,
+	secondaryClientsets map[string]kubernetes.Interface,
+) {
+	for _, c := range clusters {
+		clientSet, ok := secondaryClientsets[c.Cluster]
+		if !ok || c.State == plumberv1.ClusterSyncStateSkipped {
+			continue
+		}
+
+		clusterCtx, cancel := r.clusterContext(ctx)
+		events, err := clientSet.CoreV1().
+			Events(replicator.Spec.ReplicationNamespace).
+			List(clusterCtx, metav1.ListOptions{FieldSelector: "type=" + corev1.EventTypeWarning})
+		cancel()
+		if err != nil {
+			log.Error(err, fmt.Sprintf("Unable to list events for cluster %s.", c.Cluster))
+			continue
+		}
+
+		key := replicatorClusterKey(replicator.GetUID(), c.Cluster)
+		r.mirroredMu.Lock()
+		since, ok := r.mirrored[key]
+		r.mirroredMu.Unlock()
+		if !ok {
+			since = r.startTime
+		}
+
+		var mirrored []corev1.Event
+		for _, event := range events.Items {
+			if event.Type != corev1.EventTypeWarning ||
+				!mirroredEventReasons[event.Reason] ||
+				!isReplicatedObject(*replicator, event.InvolvedObject) ||
+				!eventTime(event).After(since) {
+				continue
+			}
+			mirrored = append(mirrored, event)
+		}
+		if len(mirrored) == 0 {
+			continue
+		}
+
+		sort.Slice(mirrored, func(i, j int) bool {
+			return eventTime(mirrored[i]).Before(eventTime(mirrored[j]))
+		})
+		for _, event := range mirrored {
+			r.eventf(
+				replicator,
+				corev1.EventTypeWarning,
+				event.Reason,
+				"[%s] %s/%s: %s",
+				c.Cluster,
+				event.InvolvedObject.Kind,
+				event.InvolvedObject.Name,
+				event.Message,
+			)
+		}
+
+		r.mirroredMu.Lock()
+		if r.mirrored == nil {
+			r.mirrored = make(map[string]time.Time)
+		}
+		r.mirrored[key] = eventTime(mirrored[len(mirrored)-1])
+		r.mirroredMu.Unlock()
+	}
+}
+
+// Forget the mirrored events of a deleted Replicator.
+func (r *ReplicatorReconciler) forgetMirroredEvents(replicator plumberv1.Replicator) {
+	r.mirroredMu.Lock()
+	defer r.mirroredMu.Unlock()
+
+	for _, cluster := range replicator.Spec.TargetCluster {
+		delete(r.mirrored, replicatorClusterKey(replicator.GetUID(), cluster))
+	}
+}
@@ -0,0 +1,161 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// Interval at which the health is read back again while the workload is not healthy on every cluster,
+// e.g. while the Pods of a new rollout are starting.
+const healthPollInterval = 15 * time.Second
+
+// Read back the replicated Deployment, Service and Ingress and determine the health of the workload.
+func workloadHealth(
+	ctx context.Context,
+	replicator plumberv1.Replicator,
+	clientSet kubernetes.Interface,
+	versions apiVersions,
+) *plumberv1.WorkloadHealth {
+	var (
+		namespace = replicator.Spec.ReplicationNamespace
+		health    = &plumberv1.WorkloadHealth{State: plumberv1.WorkloadHealthHealthy}
+	)
+
+	deployment, err := clientSet.AppsV1().
+		Deployments(namespace).
+		Get(ctx, replicator.Spec.DeploymentName, metav1.GetOptions{})
+	if err != nil {
+		health.State = plumberv1.WorkloadHealthUnknown
+		health.Message = fmt.Sprintf("failed to get Deployment: %s", err)
+		return health
+	}
+	health.Replicas = 1
+	if deployment.Spec.Replicas != nil {
+		health.Replicas = *deployment.Spec.Replicas
+	}
+	health.ReadyReplicas = deployment.Status.ReadyReplicas
+	health.AvailableReplicas = deployment.Status.AvailableReplicas
+
+	if replicator.Spec.ServiceSpec != nil {
+		endpoints, err := clientSet.CoreV1().
+			Endpoints(namespace).
+			Get(ctx, replicator.Spec.ServiceName, metav1.GetOptions{})
+		// The endpoints controller may not have created the Endpoints yet.
+		if err != nil && !errors.IsNotFound(err) {
+			health.State = plumberv1.WorkloadHealthUnknown
+			health.Message = fmt.Sprintf("failed to get Endpoints: %s", err)
+			return health
+		}
+		if err == nil {
+			for _, subset := range endpoints.Subsets {
+				health.ReadyEndpoints += int32(len(subset.Addresses))
+				health.NotReadyEndpoints += int32(len(subset.NotReadyAddresses))
+			}
+		}
+	}
+
+	if replicator.Spec.IngressSpec != nil {
+		addresses, err := ingressAddresses(
+			ctx,
+			clientSet,
+			versions.of(kindIngress),
+			namespace,
+			replicator.Spec.IngressName,
+		)
+		if err != nil {
+			health.State = plumberv1.WorkloadHealthUnknown
+			health.Message = fmt.Sprintf("failed to get Ingress: %s", err)
+			return health
+		}
+		health.IngressAddresses = addresses
+	}
+
+	// The Ingress addresses are only reported, since not every cluster runs a load balancer.
+	switch {
+	case health.AvailableReplicas < health.Replicas:
+		health.State = plumberv1.WorkloadHealthUnhealthy
+		health.Message = fmt.Sprintf("%d of %d replicas available", health.AvailableReplicas, health.Replicas)
+	case health.ReadyReplicas < health.Replicas:
+		health.State = plumberv1.WorkloadHealthUnhealthy
+		health.Message = fmt.Sprintf("%d of %d replicas ready", health.ReadyReplicas, health.Replicas)
+	case replicator.Spec.ServiceSpec != nil && health.Replicas > 0 && health.ReadyEndpoints == 0:
+		health.State = plumberv1.WorkloadHealthUnhealthy
+		health.Message = "Service has no ready endpoints"
+	}
+
+	return health
+}
+
+// Determine whether the workload has been read back on a cluster and is not healthy there.
+// Clusters that were not replicated to have no workload health and are retried on their own.
+func unhealthyWorkload(clusters []plumberv1.ClusterSyncStatus) bool {
+	for _, c := range clusters {
+		if c.Workload != nil && c.Workload.State != plumberv1.WorkloadHealthHealthy {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Roll the workload health of all clusters up into the health of the fleet.
+// Clusters whose workload could not be read back count as not healthy.
+func fleetHealth(clusters []plumberv1.ClusterSyncStatus) *plumberv1.FleetHealth {
+	if len(clusters) == 0 {
+		return nil
+	}
+
+	health := &plumberv1.FleetHealth{Clusters: int32(len(clusters))}
+	for _, c := range clusters {
+		if c.Workload == nil {
+			continue
+		}
+		if c.Workload.State == plumberv1.WorkloadHealthHealthy {
+			health.HealthyClusters++
+		}
+		health.Replicas += c.Workload.Replicas
+		health.ReadyReplicas += c.Workload.ReadyReplicas
+		health.AvailableReplicas += c.Workload.AvailableReplicas
+	}
+
+	switch health.HealthyClusters {
+	case health.Clusters:
+		health.State = plumberv1.FleetHealthHealthy
+	case 0:
+		health.State = plumberv1.FleetHealthUnhealthy
+	default:
+		health.State = plumberv1.FleetHealthDegraded
+	}
+
+	return health
+}
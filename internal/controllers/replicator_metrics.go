@@ -0,0 +1,89 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/metrics"
+)
+
+// Sync of a generation of a Replicator, for measuring the replication lag.
+type generationSync struct {
+	generation int64
+	start      time.Time
+	observed   bool
+}
+
+// Remember when the controller first saw the current generation of the Replicator.
+// The first generation started when the Replicator was created.
+// A generation that had already been handled before the controller started is not measured,
+// since the time it changed is unknown.
+func (r *ReplicatorReconciler) startGeneration(replicator plumberv1.Replicator) {
+	r.generationsMu.Lock()
+	defer r.generationsMu.Unlock()
+
+	if s, ok := r.generations[replicator.GetUID()]; ok && s.generation == replicator.GetGeneration() {
+		return
+	}
+
+	s := generationSync{generation: replicator.GetGeneration(), start: time.Now()}
+	switch {
+	case replicator.Status.ObservedGeneration == replicator.GetGeneration():
+		s.observed = true
+	case replicator.GetGeneration() == 1:
+		s.start = replicator.GetCreationTimestamp().Time
+	}
+
+	if r.generations == nil {
+		r.generations = make(map[types.UID]generationSync)
+	}
+	r.generations[replicator.GetUID()] = s
+}
+
+// Observe the replication lag once the current generation has been synced to all clusters.
+func (r *ReplicatorReconciler) observeReplicationLag(replicator plumberv1.Replicator) {
+	r.generationsMu.Lock()
+	defer r.generationsMu.Unlock()
+
+	s, ok := r.generations[replicator.GetUID()]
+	if !ok || s.observed || s.generation != replicator.GetGeneration() {
+		return
+	}
+
+	metrics.ReplicationLag.Observe(time.Since(s.start).Seconds())
+	s.observed = true
+	r.generations[replicator.GetUID()] = s
+}
+
+// Forget the generation of a deleted Replicator.
+func (r *ReplicatorReconciler) forgetGeneration(replicator plumberv1.Replicator) {
+	r.generationsMu.Lock()
+	defer r.generationsMu.Unlock()
+
+	delete(r.generations, replicator.GetUID())
+}
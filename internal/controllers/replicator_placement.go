@@ -0,0 +1,231 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/constants"
+)
+
+// Incompatible clusters are checked again after this time,
+// so that a Replicator is replicated to a cluster once the missing capability has been installed.
+const capabilityRecheckInterval = 5 * time.Minute
+
+// Remember that the cluster is incompatible with the Replicator.
+func (r *ReplicatorReconciler) markIncompatible(replicator plumberv1.Replicator, cluster string) {
+	r.incompatibleMu.Lock()
+	defer r.incompatibleMu.Unlock()
+
+	if r.incompatible == nil {
+		r.incompatible = make(map[string]time.Time)
+	}
+	key := replicatorClusterKey(replicator.GetUID(), cluster)
+	if _, ok := r.incompatible[key]; !ok {
+		r.incompatible[key] = time.Now()
+	}
+}
+
+func (r *ReplicatorReconciler) forgetIncompatible(replicator plumberv1.Replicator, cluster string) {
+	r.incompatibleMu.Lock()
+	defer r.incompatibleMu.Unlock()
+
+	delete(r.incompatible, replicatorClusterKey(replicator.GetUID(), cluster))
+}
+
+// Discard the cached discovery results of a cluster that is incompatible with the Replicator
+// once capabilityRecheckInterval has passed, so that a newly installed capability is found.
+// The discovery results are kept in between, since the cluster is checked on every reconcile.
+func (r *ReplicatorReconciler) recheckCapabilities(replicator plumberv1.Replicator, cluster string) {
+	r.incompatibleMu.Lock()
+	defer r.incompatibleMu.Unlock()
+
+	key := replicatorClusterKey(replicator.GetUID(), cluster)
+	since, ok := r.incompatible[key]
+	if !ok || time.Since(since) < capabilityRecheckInterval {
+		return
+	}
+	r.incompatible[key] = time.Now()
+	r.Clientsets.InvalidateDiscovery(cluster)
+}
+
+// Kinds of capabilities.
+const (
+	capabilityAPI          = "API"
+	capabilityIngressClass = "IngressClass"
+	capabilityStorageClass = "StorageClass"
+)
+
+// A capability that a cluster must have for the Replicator to be replicated to it.
+type capability struct {
+	kind string
+	// Group version of an API, or the name of an IngressClass or StorageClass.
+	name string
+	// Resource of an API. If empty, any resource of the group version is enough.
+	resource string
+}
+
+func (c capability) String() string {
+	if c.resource != "" {
+		return fmt.Sprintf("%s %s/%s", c.kind, c.name, c.resource)
+	}
+
+	return fmt.Sprintf("%s %s", c.kind, c.name)
+}
+
+// Return the capabilities that the resources of the Replicator need on a cluster.
+// The Deployment, Service, ConfigMap and Secrets are served by every cluster and are not included.
+// The IngressClass is always the one set by applyIngress.
+func requiredCapabilities(replicator plumberv1.Replicator) []capability {
+	var required []capability
+
+	// The version of the Ingress API is negotiated separately, see negotiateVersions.
+	if replicator.Spec.IngressSpec != nil {
+		required = append(required, capability{kind: capabilityIngressClass, name: constants.IngressClassName})
+	}
+
+	for _, api := range replicator.Spec.RequiredAPIs {
+		required = append(required, capability{kind: capabilityAPI, name: api.GroupVersion, resource: api.Resource})
+	}
+
+	storageClasses := make(map[string]bool)
+	if spec := replicator.Spec.DeploymentSpec; spec != nil && spec.Template != nil && spec.Template.Spec != nil {
+		for _, volume := range spec.Template.Spec.Volumes {
+			if volume.Ephemeral == nil ||
+				volume.Ephemeral.VolumeClaimTemplate == nil ||
+				volume.Ephemeral.VolumeClaimTemplate.Spec == nil ||
+				volume.Ephemeral.VolumeClaimTemplate.Spec.StorageClassName == nil {
+				continue
+			}
+			if name := *volume.Ephemeral.VolumeClaimTemplate.Spec.StorageClassName; name != "" {
+				storageClasses[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(storageClasses))
+	for name := range storageClasses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		required = append(required, capability{kind: capabilityStorageClass, name: name})
+	}
+
+	return required
+}
+
+// Return the required capabilities that the cluster lacks.
+// The IngressClass is looked up in the version of the networking API negotiated for the Ingress.
+// Capabilities that could not be checked, e.g. because the cluster did not respond, are not reported as missing,
+// but their errors are returned.
+func missingCapabilities(
+	ctx context.Context,
+	clientSet kubernetes.Interface,
+	required []capability,
+	versions apiVersions,
+) ([]capability, error) {
+	var (
+		errs    error
+		missing []capability
+	)
+
+	for _, c := range required {
+		var err error
+		switch c.kind {
+		case capabilityAPI:
+			var resources *metav1.APIResourceList
+			resources, err = discoverResources(ctx, clientSet, c.name)
+			if err == nil && c.resource != "" && !servesResource(resources, c.resource) {
+				missing = append(missing, c)
+				continue
+			}
+		case capabilityIngressClass:
+			err = getIngressClass(ctx, clientSet, versions.of(kindIngress), c.name)
+		case capabilityStorageClass:
+			_, err = clientSet.StorageV1().StorageClasses().Get(ctx, c.name, metav1.GetOptions{})
+		}
+
+		switch {
+		case errors.IsNotFound(err):
+			missing = append(missing, c)
+		case err != nil:
+			errs = multierr.Append(errs, fmt.Errorf("failed to check %s: %w", c, err))
+		}
+	}
+
+	return missing, errs
+}
+
+// Get the IngressClass in the group version that the Ingress is applied in.
+// Clusters older than v1.18 have no IngressClass API, so the IngressClass cannot be checked and is assumed to exist.
+func getIngressClass(ctx context.Context, clientSet kubernetes.Interface, version schema.GroupVersion, name string) error {
+	if version != networkingv1beta1.SchemeGroupVersion {
+		_, err := clientSet.NetworkingV1().IngressClasses().Get(ctx, name, metav1.GetOptions{})
+		return err
+	}
+
+	resources, err := discoverResources(ctx, clientSet, version.String())
+	if err != nil {
+		return err
+	}
+	if !servesResource(resources, "ingressclasses") {
+		return nil
+	}
+	_, err = clientSet.NetworkingV1beta1().IngressClasses().Get(ctx, name, metav1.GetOptions{})
+
+	return err
+}
+
+// Return whether the resource is in the list of the group version.
+func servesResource(resources *metav1.APIResourceList, resource string) bool {
+	for _, r := range resources.APIResources {
+		if r.Name == resource {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the message of a cluster that was skipped because it lacks the capabilities.
+func incompatibleMessage(missing []capability) string {
+	names := make([]string, 0, len(missing))
+	for _, c := range missing {
+		names = append(names, c.String())
+	}
+
+	return fmt.Sprintf("incompatible cluster, missing %s", strings.Join(names, ", "))
+}
@@ -0,0 +1,89 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// Count the clusters by the result of the last replication.
+// Drifted and rolled back clusters are not in sync with the Replicator, so they count as failed.
+func countClusters(clusters []plumberv1.ClusterSyncStatus) (succeeded, failed, skipped int32) {
+	for _, c := range clusters {
+		switch c.State {
+		case plumberv1.ClusterSyncStateApplied:
+			succeeded++
+		case plumberv1.ClusterSyncStateSkipped:
+			skipped++
+		default:
+			failed++
+		}
+	}
+
+	return succeeded, failed, skipped
+}
+
+// Determine the sync state of the Replicator from the result of the replication.
+// The Replicator is Degraded if not all clusters were applied,
+// but at least .spec.syncPolicy.minSuccessfulClusters of them.
+// A failure on the primary cluster stops the replication, so the Replicator is Failed.
+func syncState(
+	replicator plumberv1.Replicator,
+	clusters []plumberv1.ClusterSyncStatus,
+	primaryClusters map[string]bool,
+) (string, error) {
+	succeeded, _, _ := countClusters(clusters)
+	total := len(clusters)
+	if int(succeeded) == total {
+		return plumberv1.SyncStateSynced, nil
+	}
+
+	for _, c := range clusters {
+		if primaryClusters[c.Cluster] && c.State != plumberv1.ClusterSyncStateApplied {
+			return plumberv1.SyncStateFailed, nil
+		}
+	}
+
+	var min *intstr.IntOrString
+	if replicator.Spec.SyncPolicy != nil {
+		min = replicator.Spec.SyncPolicy.MinSuccessfulClusters
+	}
+	if min == nil {
+		return plumberv1.SyncStateFailed, nil
+	}
+
+	required, err := intstr.GetScaledValueFromIntOrPercent(min, total, true)
+	if err != nil {
+		return plumberv1.SyncStateFailed, fmt.Errorf("invalid minSuccessfulClusters: %w", err)
+	}
+	if int(succeeded) < required {
+		return plumberv1.SyncStateFailed, nil
+	}
+
+	return plumberv1.SyncStateDegraded, nil
+}
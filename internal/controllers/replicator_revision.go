@@ -0,0 +1,277 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/go-logr/logr"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/constants"
+)
+
+const defaultRevisionHistoryLimit = 10
+
+// Return the part of the spec that is recorded in a revision.
+// The fields that control plumber itself rather than what is pushed to the clusters are left out,
+// so that they neither create new revisions nor are changed by a rollback.
+func revisionSpec(spec plumberv1.ReplicatorSpec) plumberv1.ReplicatorSpec {
+	spec.Suspend = false
+	spec.DryRun = false
+	spec.RevisionHistoryLimit = nil
+	spec.RollbackTo = nil
+
+	return spec
+}
+
+// Create a ControllerRevision holding the spec of the Replicator.
+// The name is derived from the hash of the spec, so that the same spec always maps to the same revision.
+func newRevision(replicator plumberv1.Replicator, revision int64) (*appsv1.ControllerRevision, error) {
+	data, err := json.Marshal(revisionSpec(replicator.Spec))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode revision: %w", err)
+	}
+
+	hasher := fnv.New32a()
+	hasher.Write(data)
+
+	return &appsv1.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: constants.Namespace,
+			Name:      fmt.Sprintf("%s-%s", replicator.GetName(), rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))),
+			Labels:    replicatorLabels(replicator),
+		},
+		Data:     runtime.RawExtension{Raw: data},
+		Revision: revision,
+	}, nil
+}
+
+// Return the revisions of the Replicator, oldest first.
+func (r *ReplicatorReconciler) listRevisions(
+	ctx context.Context,
+	replicator plumberv1.Replicator,
+) ([]appsv1.ControllerRevision, error) {
+	var revisions appsv1.ControllerRevisionList
+	if err := r.List(
+		ctx,
+		&revisions,
+		client.InNamespace(constants.Namespace),
+		client.MatchingLabels(replicatorLabels(replicator)),
+	); err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+
+	sort.Slice(revisions.Items, func(i, j int) bool {
+		return revisions.Items[i].Revision < revisions.Items[j].Revision
+	})
+
+	return revisions.Items, nil
+}
+
+// Decode the spec held by a revision.
+func revisionToSpec(revision appsv1.ControllerRevision) (plumberv1.ReplicatorSpec, error) {
+	var spec plumberv1.ReplicatorSpec
+	if err := json.Unmarshal(revision.Data.Raw, &spec); err != nil {
+		return spec, fmt.Errorf("failed to decode revision %d: %w", revision.Revision, err)
+	}
+
+	return spec, nil
+}
+
+// Record the spec that has been synced to all clusters as the newest revision.
+// A spec that is already in the history, e.g. after a rollback, gets a new revision number instead of a new revision.
+// Revisions beyond .spec.revisionHistoryLimit are deleted, oldest first.
+func (r *ReplicatorReconciler) recordRevision(
+	ctx context.Context,
+	log logr.Logger,
+	replicator *plumberv1.Replicator,
+) error {
+	revisions, err := r.listRevisions(ctx, *replicator)
+	if err != nil {
+		return err
+	}
+
+	next, err := newRevision(*replicator, 1)
+	if err != nil {
+		return err
+	}
+	if len(revisions) > 0 {
+		next.Revision = revisions[len(revisions)-1].Revision + 1
+	}
+
+	// The specs are compared re-encoded, since the API server may not return the data byte for byte.
+	var current *appsv1.ControllerRevision
+	for i := range revisions {
+		spec, err := revisionToSpec(revisions[i])
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(spec)
+		if err != nil {
+			return fmt.Errorf("failed to encode revision: %w", err)
+		}
+		if bytes.Equal(data, next.Data.Raw) {
+			current = &revisions[i]
+		}
+	}
+
+	switch {
+	case current == nil:
+		if err := controllerutil.SetControllerReference(replicator, next, r.Scheme); err != nil {
+			return fmt.Errorf("failed to set owner reference on revision: %w", err)
+		}
+		if err := r.Create(ctx, next); err != nil {
+			return fmt.Errorf("failed to create revision: %w", err)
+		}
+		log.Info(fmt.Sprintf("Revision recorded: [revision] %d", next.Revision))
+		revisions = append(revisions, *next)
+	case current.Revision != revisions[len(revisions)-1].Revision:
+		current.Revision = next.Revision
+		if err := r.Update(ctx, current); err != nil {
+			return fmt.Errorf("failed to update revision: %w", err)
+		}
+		log.Info(fmt.Sprintf("Revision recorded: [revision] %d", next.Revision))
+		sort.Slice(revisions, func(i, j int) bool {
+			return revisions[i].Revision < revisions[j].Revision
+		})
+	}
+
+	limit := defaultRevisionHistoryLimit
+	if replicator.Spec.RevisionHistoryLimit != nil {
+		limit = int(*replicator.Spec.RevisionHistoryLimit)
+	}
+	for len(revisions) > limit {
+		if err := r.Delete(ctx, &revisions[0]); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete revision: %w", err)
+		}
+		revisions = revisions[1:]
+	}
+
+	replicator.Status.CurrentRevision = revisions[len(revisions)-1].Revision
+	replicator.Status.Revisions = nil
+	for _, revision := range revisions {
+		replicator.Status.Revisions = append(replicator.Status.Revisions, revision.Revision)
+	}
+
+	return nil
+}
+
+// Return a copy of the Replicator with the spec of its newest revision,
+// i.e. the spec that was last synced to all clusters.
+// It returns false if no revision has been recorded yet.
+func (r *ReplicatorReconciler) stableReplicator(
+	ctx context.Context,
+	replicator plumberv1.Replicator,
+) (plumberv1.Replicator, bool, error) {
+	revisions, err := r.listRevisions(ctx, replicator)
+	if err != nil || len(revisions) == 0 {
+		return replicator, false, err
+	}
+
+	spec, err := revisionToSpec(revisions[len(revisions)-1])
+	if err != nil {
+		return replicator, false, err
+	}
+	stable := *replicator.DeepCopy()
+	stable.Spec = spec
+
+	return stable, true, nil
+}
+
+// Replace the spec with the spec of the revision in .spec.rollbackTo and clear the field.
+// If the revision is not in the history, only the field is cleared.
+func (r *ReplicatorReconciler) rollbackToRevision(
+	ctx context.Context,
+	log logr.Logger,
+	replicator *plumberv1.Replicator,
+) error {
+	revisions, err := r.listRevisions(ctx, *replicator)
+	if err != nil {
+		return err
+	}
+
+	// Without a revision number, the revision before the current one is used.
+	target := replicator.Spec.RollbackTo.Revision
+	if target == 0 {
+		for _, revision := range revisions {
+			if revision.Revision < replicator.Status.CurrentRevision {
+				target = revision.Revision
+			}
+		}
+	}
+
+	var found *appsv1.ControllerRevision
+	for i := range revisions {
+		if revisions[i].Revision == target {
+			found = &revisions[i]
+		}
+	}
+
+	spec := replicator.Spec
+	if found == nil {
+		r.eventf(
+			replicator,
+			corev1.EventTypeWarning,
+			"RollbackRevisionNotFound",
+			"Unable to find revision %d to roll back to",
+			replicator.Spec.RollbackTo.Revision,
+		)
+	} else {
+		if spec, err = revisionToSpec(*found); err != nil {
+			return err
+		}
+		// The fields that are not recorded in revisions keep their current values.
+		spec.Suspend = replicator.Spec.Suspend
+		spec.DryRun = replicator.Spec.DryRun
+		spec.RevisionHistoryLimit = replicator.Spec.RevisionHistoryLimit
+
+		r.eventf(
+			replicator,
+			corev1.EventTypeNormal,
+			"RolledBack",
+			"Rolled back to revision %d",
+			found.Revision,
+		)
+		log.Info(fmt.Sprintf("Rollback: [revision] %d", found.Revision))
+	}
+	spec.RollbackTo = nil
+	replicator.Spec = spec
+
+	return r.Update(ctx, replicator)
+}
@@ -0,0 +1,328 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// Interval at which the Deployments of the current wave are checked while they become Available.
+const rolloutPollInterval = 10 * time.Second
+
+// Secondary clusters of a Replicator grouped into waves.
+// The first wave holds the canary clusters if .spec.rollout.canary is set,
+// and the last wave holds the clusters that do not belong to any wave of .spec.rollout.waves.
+type rolloutPlan [][]string
+
+// Assign the secondary clusters in .spec.targetCluster to the waves of .spec.rollout.
+// A cluster belongs to the first wave that names it or whose selector matches its ClusterDetector.
+func planRollout(
+	replicator plumberv1.Replicator,
+	clusterDetectors []plumberv1.ClusterDetector,
+) (rolloutPlan, error) {
+	targets := make(map[string]bool)
+	for _, cluster := range replicator.Spec.TargetCluster {
+		targets[cluster] = true
+	}
+
+	assigned := make(map[string]bool)
+	assign := func(wave []string, cluster string) []string {
+		if !targets[cluster] || assigned[cluster] {
+			return wave
+		}
+		assigned[cluster] = true
+		return append(wave, cluster)
+	}
+
+	sort.Slice(clusterDetectors, func(i, j int) bool {
+		return clusterDetectors[i].GetName() < clusterDetectors[j].GetName()
+	})
+
+	var plan rolloutPlan
+	if canary := replicator.Spec.Rollout.Canary; canary != nil {
+		var wave []string
+		for _, cluster := range canary.Clusters {
+			wave = assign(wave, cluster)
+		}
+		plan = append(plan, wave)
+	}
+
+	for i, w := range replicator.Spec.Rollout.Waves {
+		var wave []string
+		for _, cluster := range w.Clusters {
+			wave = assign(wave, cluster)
+		}
+
+		if w.ClusterSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(w.ClusterSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid clusterSelector in wave %d: %w", i, err)
+			}
+			for _, clusterDetector := range clusterDetectors {
+				if selector.Matches(labels.Set(clusterDetector.GetLabels())) {
+					wave = assign(wave, clusterDetector.GetName())
+				}
+			}
+		}
+
+		plan = append(plan, wave)
+	}
+
+	var rest []string
+	for _, cluster := range replicator.Spec.TargetCluster {
+		rest = assign(rest, cluster)
+	}
+	if len(rest) > 0 {
+		plan = append(plan, rest)
+	}
+
+	return plan, nil
+}
+
+// Return the wave index of each cluster.
+func (p rolloutPlan) waveOf() map[string]int32 {
+	waves := make(map[string]int32)
+	for i, wave := range p {
+		for _, cluster := range wave {
+			waves[cluster] = int32(i)
+		}
+	}
+
+	return waves
+}
+
+// Reset the rollout status when a new generation of the Replicator is to be rolled out.
+func startRollout(replicator *plumberv1.Replicator) *plumberv1.RolloutStatus {
+	status := replicator.Status.Rollout
+	if status == nil || status.ObservedGeneration != replicator.GetGeneration() {
+		status = &plumberv1.RolloutStatus{
+			ObservedGeneration: replicator.GetGeneration(),
+			Phase:              plumberv1.RolloutPhaseProgressing,
+		}
+		replicator.Status.Rollout = status
+	}
+
+	return status
+}
+
+// Return the clientsets of the clusters in the waves that have been started.
+// After a rollback no cluster gets the new spec, the canary clusters are replicated to with the stable spec instead.
+func rolloutTargets(
+	plan rolloutPlan,
+	status *plumberv1.RolloutStatus,
+	secondaryClientsets map[string]kubernetes.Interface,
+) map[string]kubernetes.Interface {
+	waves := plan.waveOf()
+
+	targets := make(map[string]kubernetes.Interface)
+	if status.Phase == plumberv1.RolloutPhaseRolledBack {
+		return targets
+	}
+	for cluster, clientSet := range secondaryClientsets {
+		if wave, ok := waves[cluster]; ok && wave <= status.CurrentWave {
+			targets[cluster] = clientSet
+		}
+	}
+
+	return targets
+}
+
+// Determine whether the replicated Deployment is Available with its current generation
+// and all of its replicas have been updated.
+func deploymentRolloutState(
+	ctx context.Context,
+	replicator plumberv1.Replicator,
+	clientSet kubernetes.Interface,
+) (string, string) {
+	deployment, err := clientSet.AppsV1().
+		Deployments(replicator.Spec.ReplicationNamespace).
+		Get(ctx, replicator.Spec.DeploymentName, metav1.GetOptions{})
+	if err != nil {
+		return plumberv1.ClusterRolloutStateProgressing, fmt.Sprintf("failed to get Deployment: %s", err)
+	}
+
+	if deployment.Status.ObservedGeneration < deployment.GetGeneration() {
+		return plumberv1.ClusterRolloutStateProgressing, "waiting for the new generation to be observed"
+	}
+
+	var available bool
+	for _, c := range deployment.Status.Conditions {
+		switch {
+		case c.Type == appsv1.DeploymentProgressing &&
+			c.Status == corev1.ConditionFalse &&
+			c.Reason == "ProgressDeadlineExceeded":
+			return plumberv1.ClusterRolloutStateFailed, c.Message
+		case c.Type == appsv1.DeploymentAvailable && c.Status == corev1.ConditionTrue:
+			available = true
+		}
+	}
+	if !available {
+		return plumberv1.ClusterRolloutStateProgressing, "waiting for the Deployment to become Available"
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	if deployment.Status.UpdatedReplicas < replicas {
+		return plumberv1.ClusterRolloutStateProgressing, fmt.Sprintf(
+			"%d of %d replicas updated", deployment.Status.UpdatedReplicas, replicas)
+	}
+
+	return plumberv1.ClusterRolloutStateAvailable, ""
+}
+
+// Update the rollout state of each cluster from the result of the replication
+// and start the next wave once all clusters of the current wave are Available.
+// The returned Result requeues the Replicator to check or start the next wave.
+func (r *ReplicatorReconciler) progressRollout(
+	ctx context.Context,
+	log logr.Logger,
+	replicator *plumberv1.Replicator,
+	plan rolloutPlan,
+	targets map[string]kubernetes.Interface,
+	result ReplicateResult,
+) ctrl.Result {
+	status := replicator.Status.Rollout
+	pauseOnFailure := replicator.Spec.Rollout.PauseOnFailure
+
+	replicated := make(map[string]plumberv1.ClusterSyncStatus)
+	for _, c := range result.Clusters {
+		replicated[c.Cluster] = c
+	}
+
+	var (
+		clusters []plumberv1.ClusterRolloutStatus
+		done     = true
+		failed   bool
+	)
+	for i, wave := range plan {
+		for _, cluster := range wave {
+			s := plumberv1.ClusterRolloutStatus{
+				Cluster: cluster,
+				Wave:    int32(i),
+				State:   plumberv1.ClusterRolloutStatePending,
+			}
+
+			switch {
+			case status.Phase == plumberv1.RolloutPhaseRolledBack:
+				if int32(i) <= status.CurrentWave {
+					s.State = plumberv1.ClusterRolloutStateRolledBack
+					s.Message = "rolled back to the stable spec"
+				}
+			case int32(i) <= status.CurrentWave:
+				c, ok := replicated[cluster]
+				switch {
+				case !ok:
+					// The replication stopped before the cluster, e.g. because the primary cluster failed.
+					s.State = plumberv1.ClusterRolloutStateProgressing
+					s.Message = "not replicated"
+				case c.State == plumberv1.ClusterSyncStateFailed:
+					s.State = plumberv1.ClusterRolloutStateFailed
+					s.Message = c.Message
+				case c.State == plumberv1.ClusterSyncStateSkipped:
+					s.State = plumberv1.ClusterRolloutStateProgressing
+					s.Message = c.Message
+				default:
+					clusterCtx, cancel := r.clusterContext(ctx)
+					s.State, s.Message = deploymentRolloutState(clusterCtx, *replicator, targets[cluster])
+					cancel()
+				}
+			}
+
+			if int32(i) == status.CurrentWave {
+				switch s.State {
+				case plumberv1.ClusterRolloutStateFailed:
+					failed = true
+				case plumberv1.ClusterRolloutStateProgressing:
+					done = false
+				}
+			}
+
+			clusters = append(clusters, s)
+		}
+	}
+	status.Clusters = clusters
+
+	if status.Phase != plumberv1.RolloutPhaseProgressing {
+		return ctrl.Result{}
+	}
+
+	if replicator.Spec.Rollout.Canary != nil && status.CurrentWave == 0 {
+		// The canary clusters are analyzed for the bake time once their Deployments are Available.
+		// Any failure on a canary cluster fails the analysis, regardless of pauseOnFailure.
+		if failed {
+			failCanary(log, replicator, "replication to a canary cluster failed")
+			return ctrl.Result{}
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: rolloutPollInterval}
+		}
+		wait, err := r.bakeCanary(ctx, replicator, plan[0], targets)
+		if err != nil {
+			failCanary(log, replicator, err.Error())
+			return ctrl.Result{}
+		}
+		if wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}
+		}
+		log.Info("Canary analysis passed, promoting")
+	} else {
+		if failed && pauseOnFailure {
+			status.Phase = plumberv1.RolloutPhasePaused
+			log.Info(fmt.Sprintf("Rollout paused: [wave] %d", status.CurrentWave))
+			return ctrl.Result{}
+		}
+
+		if !done {
+			return ctrl.Result{RequeueAfter: rolloutPollInterval}
+		}
+	}
+
+	status.CurrentWave++
+	if int(status.CurrentWave) >= len(plan) {
+		status.CurrentWave = int32(len(plan))
+		status.Phase = plumberv1.RolloutPhaseCompleted
+		log.Info("Rollout completed")
+		return ctrl.Result{}
+	}
+
+	log.Info(fmt.Sprintf("Rollout wave started: [wave] %d, [clusters] %v", status.CurrentWave, plan[status.CurrentWave]))
+
+	return ctrl.Result{Requeue: true}
+}
@@ -0,0 +1,171 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// Record a sync that changed resources on any cluster as a ReplicationRun.
+// A sync with the same outcome as the last recorded run, e.g. a retry of an apply that keeps failing,
+// is not recorded again.
+// The run is owned by the Replicator, so that it is deleted together with it.
+func (r *ReplicatorReconciler) recordRun(
+	ctx context.Context,
+	log logr.Logger,
+	replicator plumberv1.Replicator,
+	start metav1.Time,
+	result ReplicateResult,
+) error {
+	run := &plumberv1.ReplicationRun{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("%s-", replicator.GetName()),
+			Labels:       replicatorLabels(replicator),
+		},
+		Spec: plumberv1.ReplicationRunSpec{
+			Replicator: replicator.GetName(),
+			Generation: replicator.GetGeneration(),
+		},
+	}
+	if replicator.Status.Synced == plumberv1.SyncStateSynced {
+		run.Spec.Revision = replicator.Status.CurrentRevision
+	}
+
+	resources := make(map[string][]plumberv1.ReplicationRunResource)
+	for _, c := range result.Changes {
+		resources[c.Cluster] = append(resources[c.Cluster], plumberv1.ReplicationRunResource{
+			Kind:        c.Kind,
+			Name:        c.Name,
+			ApplyStatus: c.ApplyStatus,
+			Message:     c.Message,
+		})
+	}
+
+	status := plumberv1.ReplicationRunStatus{
+		StartTime:      start,
+		CompletionTime: metav1.Now(),
+		Synced:         replicator.Status.Synced,
+	}
+	for _, c := range replicator.Status.Clusters {
+		status.Clusters = append(status.Clusters, plumberv1.ReplicationRunCluster{
+			Cluster:   c.Cluster,
+			State:     c.State,
+			Message:   c.Message,
+			Resources: resources[c.Cluster],
+		})
+	}
+
+	outcome, err := runOutcome(run.Spec, status)
+	if err != nil {
+		return err
+	}
+	last, err := r.lastRunOutcome(ctx, replicator)
+	if err != nil {
+		return err
+	}
+	if outcome == last {
+		return nil
+	}
+
+	if err := controllerutil.SetControllerReference(&replicator, run, r.Scheme); err != nil {
+		return fmt.Errorf("failed to set owner reference on ReplicationRun: %w", err)
+	}
+	if err := r.Create(ctx, run); err != nil {
+		return fmt.Errorf("failed to create ReplicationRun: %w", err)
+	}
+
+	run.Status = status
+	if err := r.Status().Update(ctx, run); err != nil {
+		return fmt.Errorf("failed to update ReplicationRun status: %w", err)
+	}
+
+	r.lastRunsMu.Lock()
+	if r.lastRuns == nil {
+		r.lastRuns = make(map[types.UID]string)
+	}
+	r.lastRuns[replicator.GetUID()] = outcome
+	r.lastRunsMu.Unlock()
+
+	log.Info(fmt.Sprintf("ReplicationRun recorded: [run] %s, [changes] %d", run.GetName(), len(result.Changes)))
+
+	return nil
+}
+
+// Return the outcome of the last ReplicationRun recorded for the Replicator.
+// After a restart of the controller, the outcome is read from the newest ReplicationRun.
+func (r *ReplicatorReconciler) lastRunOutcome(ctx context.Context, replicator plumberv1.Replicator) (string, error) {
+	r.lastRunsMu.Lock()
+	outcome, ok := r.lastRuns[replicator.GetUID()]
+	r.lastRunsMu.Unlock()
+	if ok {
+		return outcome, nil
+	}
+
+	var runs plumberv1.ReplicationRunList
+	if err := r.List(ctx, &runs, client.MatchingLabels(replicatorLabels(replicator))); err != nil {
+		return "", fmt.Errorf("failed to list ReplicationRuns: %w", err)
+	}
+	if len(runs.Items) == 0 {
+		return "", nil
+	}
+	sort.Slice(runs.Items, func(i, j int) bool {
+		return runs.Items[i].Status.CompletionTime.Before(&runs.Items[j].Status.CompletionTime)
+	})
+	newest := runs.Items[len(runs.Items)-1]
+
+	return runOutcome(newest.Spec, newest.Status)
+}
+
+// Return the outcome of a sync, i.e. the ReplicationRun without its times.
+func runOutcome(spec plumberv1.ReplicationRunSpec, status plumberv1.ReplicationRunStatus) (string, error) {
+	outcome, err := json.Marshal(struct {
+		Spec     plumberv1.ReplicationRunSpec
+		Synced   string
+		Clusters []plumberv1.ReplicationRunCluster
+	}{spec, status.Synced, status.Clusters})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal outcome of ReplicationRun: %w", err)
+	}
+
+	return string(outcome), nil
+}
+
+func (r *ReplicatorReconciler) forgetLastRun(replicator plumberv1.Replicator) {
+	r.lastRunsMu.Lock()
+	defer r.lastRunsMu.Unlock()
+
+	delete(r.lastRuns, replicator.GetUID())
+}
@@ -0,0 +1,366 @@
+/*
+MIT License
+Copyright (c) 2023 Junya Taniai
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	networkv1 "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	networkv1apply "k8s.io/client-go/applyconfigurations/networking/v1"
+	networkingv1beta1apply "k8s.io/client-go/applyconfigurations/networking/v1beta1"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/kubernetes"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/metrics"
+)
+
+const kindIngress = "Ingress"
+
+// Versions of the kinds that can be applied in more than one version, in order of preference.
+// The other kinds are served as apps/v1 and v1 by every cluster.
+var supportedVersions = map[string][]schema.GroupVersionResource{
+	kindIngress: {
+		networkv1.SchemeGroupVersion.WithResource("ingresses"),
+		networkingv1beta1.SchemeGroupVersion.WithResource("ingresses"),
+	},
+}
+
+// Version of each kind served by a cluster.
+type apiVersions map[string]schema.GroupVersion
+
+// Return the version of the kind to use on the cluster.
+// If it has not been negotiated, the preferred version is used.
+func (v apiVersions) of(kind string) schema.GroupVersion {
+	if version, ok := v[kind]; ok {
+		return version
+	}
+
+	return supportedVersions[kind][0].GroupVersion()
+}
+
+// Returned by negotiateVersions when a cluster serves none of the supported versions of a kind.
+type unsupportedVersionError struct {
+	kind     string
+	versions []schema.GroupVersionResource
+}
+
+func (e *unsupportedVersionError) Error() string {
+	versions := make([]string, 0, len(e.versions))
+	for _, version := range e.versions {
+		versions = append(versions, version.GroupVersion().String())
+	}
+
+	return fmt.Sprintf(
+		"%s unsupported on this cluster version, none of %s is served",
+		e.kind,
+		strings.Join(versions, ", "),
+	)
+}
+
+// Return the kinds of the Replicator whose version is negotiated with each cluster.
+func negotiatedKinds(replicator plumberv1.Replicator) []string {
+	var kinds []string
+	if replicator.Spec.IngressSpec != nil {
+		kinds = append(kinds, kindIngress)
+	}
+
+	return kinds
+}
+
+// Pick the most preferred version of each kind that the cluster serves.
+// If the cluster serves none of the supported versions of a kind, an unsupportedVersionError is returned.
+func negotiateVersions(ctx context.Context, clientSet kubernetes.Interface, kinds []string) (apiVersions, error) {
+	versions := make(apiVersions)
+	for _, kind := range kinds {
+		for _, version := range supportedVersions[kind] {
+			resources, err := discoverResources(ctx, clientSet, version.GroupVersion().String())
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return versions, fmt.Errorf("failed to discover %s: %w", version.GroupVersion(), err)
+			}
+			if servesResource(resources, version.Resource) {
+				versions[kind] = version.GroupVersion()
+				break
+			}
+		}
+
+		if _, ok := versions[kind]; !ok {
+			return versions, &unsupportedVersionError{kind: kind, versions: supportedVersions[kind]}
+		}
+	}
+
+	return versions, nil
+}
+
+// Negotiate the versions for reading or deleting the resources of the Replicator.
+// If a kind is served in none of the supported versions, the cluster has no resources of that kind
+// and an unsupportedVersionError is returned.
+func versionsFor(ctx context.Context, clientSet kubernetes.Interface, replicator plumberv1.Replicator) (apiVersions, error) {
+	return negotiateVersions(ctx, clientSet, negotiatedKinds(replicator))
+}
+
+// Return the resources of the group version served by the cluster.
+// The discovery client of a registered cluster caches the results, see ClusterRegistry,
+// so only the first call after the cluster was invalidated reaches the cluster.
+// Discovery requests take no context, so the request is abandoned, not cancelled, when ctx is done.
+// A group version that is not served is returned as a NotFound error.
+func discoverResources(ctx context.Context, clientSet kubernetes.Interface, groupVersion string) (*metav1.APIResourceList, error) {
+	type discovered struct {
+		resources *metav1.APIResourceList
+		err       error
+	}
+
+	done := make(chan discovered, 1)
+	go func() {
+		resources, err := clientSet.Discovery().ServerResourcesForGroupVersion(groupVersion)
+		done <- discovered{resources: resources, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case d := <-done:
+		if d.err == memory.ErrCacheNotFound {
+			gv, _ := schema.ParseGroupVersion(groupVersion)
+			return nil, errors.NewNotFound(gv.WithResource("").GroupResource(), groupVersion)
+		}
+		return d.resources, d.err
+	}
+}
+
+// Convert the Ingress to networking.k8s.io/v1beta1 for clusters older than v1.19.
+func ingressToV1beta1(
+	ingress *networkv1apply.IngressApplyConfiguration,
+) (*networkingv1beta1apply.IngressApplyConfiguration, error) {
+	converted := &networkingv1beta1apply.IngressApplyConfiguration{
+		ObjectMetaApplyConfiguration: ingress.ObjectMetaApplyConfiguration,
+	}
+	converted.WithKind(kindIngress).WithAPIVersion(networkingv1beta1.SchemeGroupVersion.String())
+	if ingress.Spec == nil {
+		return converted, nil
+	}
+
+	spec := networkingv1beta1apply.IngressSpec()
+	spec.IngressClassName = ingress.Spec.IngressClassName
+	if ingress.Spec.DefaultBackend != nil {
+		backend, err := ingressBackendToV1beta1(ingress.Spec.DefaultBackend)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert default backend: %w", err)
+		}
+		spec.WithBackend(backend)
+	}
+	for _, tls := range ingress.Spec.TLS {
+		spec.WithTLS(&networkingv1beta1apply.IngressTLSApplyConfiguration{
+			Hosts:      tls.Hosts,
+			SecretName: tls.SecretName,
+		})
+	}
+	for _, rule := range ingress.Spec.Rules {
+		convertedRule := networkingv1beta1apply.IngressRule()
+		convertedRule.Host = rule.Host
+		if rule.HTTP != nil {
+			http := networkingv1beta1apply.HTTPIngressRuleValue()
+			for _, path := range rule.HTTP.Paths {
+				convertedPath := networkingv1beta1apply.HTTPIngressPath()
+				convertedPath.Path = path.Path
+				if path.PathType != nil {
+					convertedPath.WithPathType(networkingv1beta1.PathType(*path.PathType))
+				}
+				if path.Backend != nil {
+					backend, err := ingressBackendToV1beta1(path.Backend)
+					if err != nil {
+						return nil, fmt.Errorf("failed to convert backend of path %s: %w", *path.Path, err)
+					}
+					convertedPath.WithBackend(backend)
+				}
+				http.WithPaths(convertedPath)
+			}
+			convertedRule.WithHTTP(http)
+		}
+		spec.WithRules(convertedRule)
+	}
+	converted.WithSpec(spec)
+
+	return converted, nil
+}
+
+// Convert the backend of an Ingress to networking.k8s.io/v1beta1.
+// The port of a Service backend is required, since v1beta1 has no default for it.
+func ingressBackendToV1beta1(
+	backend *networkv1apply.IngressBackendApplyConfiguration,
+) (*networkingv1beta1apply.IngressBackendApplyConfiguration, error) {
+	converted := networkingv1beta1apply.IngressBackend()
+	converted.Resource = backend.Resource
+	if backend.Service == nil {
+		return converted, nil
+	}
+
+	converted.ServiceName = backend.Service.Name
+	switch port := backend.Service.Port; {
+	case port != nil && port.Number != nil:
+		converted.WithServicePort(intstr.FromInt(int(*port.Number)))
+	case port != nil && port.Name != nil:
+		converted.WithServicePort(intstr.FromString(*port.Name))
+	default:
+		return nil, fmt.Errorf("Service backend %s has no port", *backend.Service.Name)
+	}
+
+	return converted, nil
+}
+
+// Apply the Ingress to a cluster that only serves networking.k8s.io/v1beta1.
+func (r *ReplicatorReconciler) applyIngressV1beta1(
+	applyRuntime ReplicateRuntime,
+	fieldMgr string,
+	nextIngressApplyConfig *networkv1apply.IngressApplyConfiguration,
+) error {
+	var (
+		ingressClient = applyRuntime.ClientSet.NetworkingV1beta1().Ingresses(applyRuntime.Replicator.Spec.ReplicationNamespace)
+		log           = applyRuntime.Log
+	)
+
+	next, err := ingressToV1beta1(nextIngressApplyConfig)
+	if err != nil {
+		return fmt.Errorf("%s unsupported on this cluster version, it cannot be converted to %s: %w",
+			kindIngress, networkingv1beta1.SchemeGroupVersion, err)
+	}
+
+	ingress, err := ingressClient.Get(applyRuntime.Context, *next.Name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get Ingress: %w", err)
+	}
+	curr, err := networkingv1beta1apply.ExtractIngress(ingress, fieldMgr)
+	if err != nil {
+		return fmt.Errorf("failed to extract Ingress: %w", err)
+	}
+
+	s := plumberv1.PerResourceApplyStatus{
+		Cluster:     applyRuntime.Cluster,
+		Kind:        kindIngress,
+		Name:        *next.Name,
+		ApplyStatus: "applied",
+	}
+	if applyRuntime.DryRun {
+		return previewApply(
+			applyRuntime,
+			fieldMgr,
+			s,
+			len(ingress.GetName()) > 0,
+			curr,
+			next,
+			func(opts metav1.ApplyOptions) (*networkingv1beta1.Ingress, error) {
+				return ingressClient.Apply(applyRuntime.Context, next, opts)
+			},
+			func(applied *networkingv1beta1.Ingress) (*networkingv1beta1apply.IngressApplyConfiguration, error) {
+				return networkingv1beta1apply.ExtractIngress(applied, fieldMgr)
+			},
+		)
+	}
+	if equality.Semantic.DeepEqual(curr, next) {
+		applyRuntime.SyncStatus.record(s)
+		return nil
+	}
+	if applyRuntime.Suspended {
+		s.ApplyStatus = applyStatusDrifted
+		applyRuntime.SyncStatus.record(s)
+		return nil
+	}
+
+	applyStart := time.Now()
+	applied, err := ingressClient.Apply(
+		applyRuntime.Context,
+		next,
+		metav1.ApplyOptions{
+			FieldManager: fieldMgr,
+			Force:        true,
+		},
+	)
+	metrics.ObserveApply(applyRuntime.Cluster, kindIngress, time.Since(applyStart), err)
+	if err != nil {
+		s.ApplyStatus = "not applied"
+		s.Message = err.Error()
+		applyRuntime.SyncStatus.recordChange(s)
+
+		log.Error(err, "unable to apply")
+		return fmt.Errorf("failed to apply Ingress: %w", err)
+	}
+
+	applyRuntime.SyncStatus.recordChange(s)
+
+	log.Info(fmt.Sprintf("Nginx Ingress Applied: [cluster] %s, [resource] %s, [version] %s",
+		applyRuntime.Cluster, applied.GetName(), networkingv1beta1.SchemeGroupVersion))
+
+	return nil
+}
+
+// Return the addresses of the load balancers of the Ingress.
+func ingressAddresses(
+	ctx context.Context,
+	clientSet kubernetes.Interface,
+	version schema.GroupVersion,
+	namespace string,
+	name string,
+) ([]string, error) {
+	var addresses []string
+	add := func(ip, hostname string) {
+		if ip == "" {
+			ip = hostname
+		}
+		addresses = append(addresses, ip)
+	}
+
+	if version == networkingv1beta1.SchemeGroupVersion {
+		ingress, err := clientSet.NetworkingV1beta1().Ingresses(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, lb := range ingress.Status.LoadBalancer.Ingress {
+			add(lb.IP, lb.Hostname)
+		}
+
+		return addresses, nil
+	}
+
+	ingress, err := clientSet.NetworkingV1().Ingresses(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, lb := range ingress.Status.LoadBalancer.Ingress {
+		add(lb.IP, lb.Hostname)
+	}
+
+	return addresses, nil
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	// Replication to the cluster is allowed.
+	StateClosed State = "Closed"
+	// Replication to the cluster is skipped until the cooldown has elapsed.
+	StateOpen State = "Open"
+	// A single probe is allowed to find out whether the cluster has recovered.
+	StateHalfOpen State = "HalfOpen"
+)
+
+// Breaker tracks consecutive replication failures per cluster.
+// It is shared by all Replicators, so that a broken secondary cluster is skipped
+// by every Replicator instead of each of them failing against it on every reconcile.
+//
+// After Threshold consecutive failures the circuit of the cluster opens.
+// Once the cooldown has elapsed, one probe is let through (half-open).
+// A successful probe closes the circuit, a failed one opens it again with twice the cooldown,
+// up to MaxCooldown.
+//
+// A nil Breaker allows every cluster.
+type Breaker struct {
+	threshold   int
+	cooldown    time.Duration
+	maxCooldown time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state         State
+	failures      int
+	cooldown      time.Duration
+	openedAt      time.Time
+	probeInFlight bool
+}
+
+// Create a Breaker that opens the circuit of a cluster after threshold consecutive failures.
+func New(threshold int, cooldown, maxCooldown time.Duration) *Breaker {
+	if maxCooldown < cooldown {
+		maxCooldown = cooldown
+	}
+
+	return &Breaker{
+		threshold:   threshold,
+		cooldown:    cooldown,
+		maxCooldown: maxCooldown,
+		now:         time.Now,
+		circuits:    make(map[string]*circuit),
+	}
+}
+
+func (b *Breaker) circuitLocked(cluster string) *circuit {
+	c, ok := b.circuits[cluster]
+	if !ok {
+		c = &circuit{state: StateClosed, cooldown: b.cooldown}
+		b.circuits[cluster] = c
+	}
+
+	return c
+}
+
+// Report whether the cluster may be replicated to.
+// If not, the time until the next probe is allowed is returned.
+func (b *Breaker) Allow(cluster string) (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuitLocked(cluster)
+	switch c.state {
+	case StateOpen:
+		if wait := c.openedAt.Add(c.cooldown).Sub(b.now()); wait > 0 {
+			return false, wait
+		}
+		c.state = StateHalfOpen
+		c.probeInFlight = true
+		return true, 0
+	case StateHalfOpen:
+		// Only one Replicator probes the cluster at a time.
+		if c.probeInFlight {
+			return false, b.cooldown
+		}
+		c.probeInFlight = true
+		return true, 0
+	}
+
+	return true, 0
+}
+
+// Record a successful replication.
+// It returns true if the circuit was not closed before.
+func (b *Breaker) Success(cluster string) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuitLocked(cluster)
+	recovered := c.state != StateClosed
+	*c = circuit{state: StateClosed, cooldown: b.cooldown}
+
+	return recovered
+}
+
+// Record a failed replication.
+// It returns true if the circuit has been opened by this failure.
+func (b *Breaker) Failure(cluster string) bool {
+	if b == nil || b.threshold <= 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuitLocked(cluster)
+	c.failures++
+	c.probeInFlight = false
+
+	switch c.state {
+	case StateHalfOpen:
+		// The probe failed, so wait longer before the next one.
+		c.cooldown *= 2
+		if c.cooldown > b.maxCooldown {
+			c.cooldown = b.maxCooldown
+		}
+	case StateClosed:
+		if c.failures < b.threshold {
+			return false
+		}
+	default:
+		return false
+	}
+
+	c.state = StateOpen
+	c.openedAt = b.now()
+
+	return true
+}
+
+// Close the circuit of the cluster, e.g. because its ClusterDetector reports it as running again.
+func (b *Breaker) Reset(cluster string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.circuits, cluster)
+}
+
+// Return the state of the circuit of the cluster.
+func (b *Breaker) State(cluster string) State {
+	if b == nil {
+		return StateClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.circuits[cluster]; ok {
+		return c.state
+	}
+
+	return StateClosed
+}
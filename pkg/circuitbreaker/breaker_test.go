@@ -0,0 +1,90 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	const cluster = "secondary.kubernetes-admin2"
+
+	now := time.Now()
+	b := New(3, time.Minute, 3*time.Minute)
+	b.now = func() time.Time { return now }
+
+	// The circuit opens on the third consecutive failure.
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.Allow(cluster); !ok {
+			t.Fatalf("attempt %d: expected the cluster to be allowed", i)
+		}
+		if opened := b.Failure(cluster); opened != (i == 2) {
+			t.Fatalf("attempt %d: unexpected opened %v", i, opened)
+		}
+	}
+	if ok, wait := b.Allow(cluster); ok || wait != time.Minute {
+		t.Fatalf("expected the cluster to be skipped for a minute, got %v %s", ok, wait)
+	}
+
+	// After the cooldown only a single probe is let through.
+	now = now.Add(time.Minute)
+	if ok, _ := b.Allow(cluster); !ok {
+		t.Fatal("expected a probe to be allowed")
+	}
+	if ok, _ := b.Allow(cluster); ok {
+		t.Fatal("expected a second probe to be rejected")
+	}
+
+	// A failed probe doubles the cooldown.
+	if !b.Failure(cluster) {
+		t.Fatal("expected the failed probe to open the circuit again")
+	}
+	if ok, wait := b.Allow(cluster); ok || wait != 2*time.Minute {
+		t.Fatalf("expected the cluster to be skipped for two minutes, got %v %s", ok, wait)
+	}
+
+	// A successful probe closes the circuit.
+	now = now.Add(2 * time.Minute)
+	if ok, _ := b.Allow(cluster); !ok {
+		t.Fatal("expected a probe to be allowed")
+	}
+	if !b.Success(cluster) {
+		t.Fatal("expected the successful probe to close the circuit")
+	}
+	if s := b.State(cluster); s != StateClosed {
+		t.Fatalf("expected a closed circuit, got %s", s)
+	}
+
+	// Reset closes an open circuit.
+	for i := 0; i < 3; i++ {
+		b.Failure(cluster)
+	}
+	b.Reset(cluster)
+	if ok, _ := b.Allow(cluster); !ok {
+		t.Fatal("expected the cluster to be allowed after reset")
+	}
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *Breaker
+	if ok, _ := b.Allow("cluster"); !ok {
+		t.Fatal("expected a nil breaker to allow every cluster")
+	}
+	if b.Failure("cluster") {
+		t.Fatal("expected a nil breaker never to open")
+	}
+}
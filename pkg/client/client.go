@@ -18,12 +18,9 @@ package client
 import (
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/go-logr/logr"
 
-	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -32,68 +29,23 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
-	"github.com/jnytnai0613/plumber/pkg/constants"
-	"github.com/jnytnai0613/plumber/pkg/kubeconfig"
 )
 
-func CreatePrimaryClientsets() (map[string]*kubernetes.Clientset, error) {
-	clientConfig := ctrl.GetConfigOrDie()
-	cs, err := kubernetes.NewForConfig(clientConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create clientset: %w", err)
-	}
-
-	clientsets := make(map[string]*kubernetes.Clientset)
-	clientsets[fmt.Sprintf("%s.%s", constants.ClusterName, constants.AuthInfo)] = cs
-
-	return clientsets, nil
+// ClientsetProvider returns the clientsets of the clusters that a Replicator is replicated to.
+// The key of the returned map is the cluster name in the format "ClusterName.UserName".
+// Invalidate drops the cached clientset of a cluster, together with its cached discovery results.
+// InvalidateDiscovery drops only the cached discovery results and keeps the clientset.
+type ClientsetProvider interface {
+	PrimaryClientsets(ctx context.Context) (map[string]kubernetes.Interface, error)
+	SecondaryClientsets(ctx context.Context, replicator plumberv1.Replicator) (map[string]kubernetes.Interface, error)
+	Invalidate(name string)
+	InvalidateDiscovery(name string)
 }
 
-func CreateSecondaryClientsets(
-	ctx context.Context,
-	cli client.Client,
-	replicator plumberv1.Replicator,
-) (map[string]*kubernetes.Clientset, error) {
-	var secret corev1.Secret
-
-	if err := cli.Get(ctx, client.ObjectKey{
-		Namespace: constants.KubeconfigSecretNamespace,
-		Name:      constants.KubeconfigSecretName,
-	}, &secret); err != nil {
-		return nil, fmt.Errorf("failed to get kubeconfig secret: %w", err)
-	}
-
-	// Get the list of contexts (remote Kubernetes clusters) from the kubeconfig file.
-	cmdConfig, err := kubeconfig.ReadKubeconfigFromByte(secret.Data[constants.KubeconfigSecretKey])
-	if err != nil {
-		return nil, fmt.Errorf("failed to read kubeconfig file: %w", err)
-	}
-
-	configPath := filepath.Join(os.TempDir(), "config")
-	if err := clientcmd.WriteToFile(
-		*cmdConfig,
-		configPath); err != nil {
-		return nil, fmt.Errorf("failed to write kubeconfig file: %w", err)
-	}
-
-	// Generate as many client sets as the number of contexts (remote Kubernetes clusters) read from kubeconfig.
-	clientsets := make(map[string]*kubernetes.Clientset)
-	for k, v := range cmdConfig.Contexts {
-		for _, secondaryCluster := range replicator.Spec.TargetCluster {
-			if fmt.Sprintf("%s.%s", v.Cluster, v.AuthInfo) != secondaryCluster {
-				continue
-			}
-
-			cs, err := CreateClientSetFromContext(configPath, k)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create clientset: %w", err)
-			}
-
-			clientsets[fmt.Sprintf("%s.%s", v.Cluster, v.AuthInfo)] = cs
-		}
-	}
-
-	return clientsets, nil
+// RESTConfigProvider returns the rest.Config of a cluster registered under name,
+// in the format "ClusterName.UserName".
+type RESTConfigProvider interface {
+	RESTConfig(ctx context.Context, name string) (*rest.Config, error)
 }
 
 // Create client for the custom resource.
@@ -117,8 +69,8 @@ func CreateClientSetFromRestConfig(config *rest.Config) (*kubernetes.Clientset,
 	return clientset, nil
 }
 
-// Create a clientset for the secondary cluster.
-func CreateClientSetFromContext(configPath string, currContext string) (*kubernetes.Clientset, error) {
+// Create a rest.Config for the given context of the kubeconfig file.
+func createRestConfigFromContext(configPath string, currContext string) (*rest.Config, error) {
 	// Specify the path of the kubeconfig file to be loaded in clientcmd.ClientConfigLoadingRules.
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	loadingRules.ExplicitPath = configPath
@@ -133,6 +85,16 @@ func CreateClientSetFromContext(configPath string, currContext string) (*kuberne
 		return nil, fmt.Errorf("failed to create client config: %w", err)
 	}
 
+	return clientConfig, nil
+}
+
+// Create a clientset for the secondary cluster.
+func CreateClientSetFromContext(configPath string, currContext string) (*kubernetes.Clientset, error) {
+	clientConfig, err := createRestConfigFromContext(configPath, currContext)
+	if err != nil {
+		return nil, err
+	}
+
 	clientset, err := kubernetes.NewForConfig(clientConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create clientset: %w", err)
@@ -140,3 +102,24 @@ func CreateClientSetFromContext(configPath string, currContext string) (*kuberne
 
 	return clientset, nil
 }
+
+// Create a client that can handle the plumber Custom Resources.
+// Used by plumberctl to operate on Replicators.
+func CreateClientFromContext(configPath string, currContext string) (client.Client, error) {
+	clientConfig, err := createRestConfigFromContext(configPath, currContext)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := runtime.NewScheme()
+	if err := plumberv1.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("failed to add scheme: %w", err)
+	}
+
+	kubeClient, err := client.New(clientConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	return kubeClient, nil
+}
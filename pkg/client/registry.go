@@ -0,0 +1,402 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"go.uber.org/multierr"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/constants"
+	"github.com/jnytnai0613/plumber/pkg/kubeconfig"
+	"github.com/jnytnai0613/plumber/pkg/tracing"
+)
+
+// ClusterRegistry holds a rest.Config and a clientset for every cluster registered in the kubeconfig Secret.
+// The rest.Configs are built in memory and the clientsets are reused across reconciles,
+// so that new TLS connections are only established when the credentials of a cluster change.
+// The discovery results of a clientset are cached until the cluster is invalidated.
+// A single ClusterRegistry is shared by the ClusterDetector and Replicator controllers.
+// The primary cluster is the cluster whose ClusterDetector has .spec.primary.
+type ClusterRegistry struct {
+	client        client.Client
+	primaryConfig *rest.Config
+	primaryName   string
+
+	mu               sync.RWMutex
+	primaries        map[string]bool
+	primaryClientset kubernetes.Interface
+	resourceVersion  string
+	kubeconfig       *clientcmdapi.Config
+	clusters         map[string]*registeredCluster
+}
+
+type registeredCluster struct {
+	context   string
+	cluster   clientcmdapi.Cluster
+	authInfo  clientcmdapi.AuthInfo
+	config    *rest.Config
+	clientset kubernetes.Interface
+}
+
+// Create a ClusterRegistry.
+// The primary cluster is accessed with primaryConfig, i.e. the credentials of the Controller Pod's ServiceAccount.
+// Until a ClusterDetector has .spec.primary, the primary cluster is registered under primaryName.
+// Requests to every cluster are traced.
+func NewClusterRegistry(cli client.Client, primaryConfig *rest.Config, primaryName string) *ClusterRegistry {
+	primaryConfig = rest.CopyConfig(primaryConfig)
+	primaryConfig.Wrap(tracing.WrapTransport(primaryName))
+
+	return &ClusterRegistry{
+		client:        cli,
+		primaryConfig: primaryConfig,
+		primaryName:   primaryName,
+		primaries:     map[string]bool{primaryName: true},
+		clusters:      make(map[string]*registeredCluster),
+	}
+}
+
+// The primary cluster is registered under this name until a ClusterDetector has .spec.primary.
+func (r *ClusterRegistry) PrimaryClusterName() string {
+	return r.primaryName
+}
+
+// Reload the kubeconfig Secret if it or the primary cluster has changed since the last call.
+// The cached clientset of a cluster is discarded only if its cluster or user entry has changed.
+func (r *ClusterRegistry) Refresh(ctx context.Context) error {
+	var secret corev1.Secret
+	if err := r.client.Get(ctx, client.ObjectKey{
+		Namespace: constants.KubeconfigSecretNamespace,
+		Name:      constants.KubeconfigSecretName,
+	}, &secret); err != nil {
+		return fmt.Errorf("failed to get kubeconfig secret: %w", err)
+	}
+
+	primaries, err := r.primaryClusters(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	unchanged := r.kubeconfig != nil &&
+		r.resourceVersion == secret.GetResourceVersion() &&
+		reflect.DeepEqual(r.primaries, primaries)
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cmdConfig, err := clientcmd.Load(secret.Data[constants.KubeconfigSecretKey])
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Contexts that share the identity of another context are ambiguous and are not registered.
+	duplicates := kubeconfig.DuplicateClusterIdentities(cmdConfig)
+
+	clusters := make(map[string]*registeredCluster)
+	for ctxName, v := range cmdConfig.Contexts {
+		cluster, ok := cmdConfig.Clusters[v.Cluster]
+		if !ok {
+			continue
+		}
+		authInfo, ok := cmdConfig.AuthInfos[v.AuthInfo]
+		if !ok {
+			continue
+		}
+
+		// The kubeconfig entry of the primary cluster is not used,
+		// the primary cluster is always accessed with primaryConfig.
+		name := kubeconfig.ClusterIdentity(v)
+		if primaries[name] {
+			continue
+		}
+		if _, ok := duplicates[name]; ok {
+			continue
+		}
+
+		next := &registeredCluster{
+			context:  ctxName,
+			cluster:  *cluster,
+			authInfo: *authInfo,
+		}
+
+		// Keep the existing rest.Config and clientset if the credentials have not changed.
+		if curr, ok := r.clusters[name]; ok &&
+			reflect.DeepEqual(curr.cluster, next.cluster) &&
+			reflect.DeepEqual(curr.authInfo, next.authInfo) {
+			next.config = curr.config
+			next.clientset = curr.clientset
+		}
+		clusters[name] = next
+	}
+
+	r.clusters = clusters
+	r.primaries = primaries
+	r.kubeconfig = cmdConfig
+	r.resourceVersion = secret.GetResourceVersion()
+
+	return nil
+}
+
+// Drop the cached rest.Config and clientset of the cluster registered under name,
+// so that they are rebuilt on next use. This also discards the cached discovery results of the cluster,
+// e.g. after an API has been installed on it or it has been upgraded.
+func (r *ClusterRegistry) Invalidate(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.primaries[name] {
+		r.primaryClientset = nil
+		return
+	}
+	if c, ok := r.clusters[name]; ok {
+		c.config = nil
+		c.clientset = nil
+	}
+}
+
+// Drop the cached discovery results of the cluster registered under name,
+// so that its APIs are discovered again on next use, e.g. after an API has been installed on it.
+// Unlike Invalidate, the clientset and its connections are kept.
+func (r *ClusterRegistry) InvalidateDiscovery(name string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var cs kubernetes.Interface
+	if r.primaries[name] {
+		cs = r.primaryClientset
+	} else if c, ok := r.clusters[name]; ok {
+		cs = c.clientset
+	}
+	if cached, ok := cs.(*cachedClientset); ok {
+		cached.discovery.Invalidate()
+	}
+}
+
+// Return the kubeconfig read from the Secret.
+func (r *ClusterRegistry) Kubeconfig(ctx context.Context) (*clientcmdapi.Config, error) {
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.kubeconfig.DeepCopy(), nil
+}
+
+// Return the rest.Config of the cluster registered under name.
+func (r *ClusterRegistry) RESTConfig(ctx context.Context, name string) (*rest.Config, error) {
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.restConfigLocked(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return rest.CopyConfig(c), nil
+}
+
+// Return the clientset of the cluster registered under name.
+// The clientset is created on first use and cached until the credentials of the cluster change.
+func (r *ClusterRegistry) Clientset(ctx context.Context, name string) (kubernetes.Interface, error) {
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.clientsetLocked(name)
+}
+
+func (r *ClusterRegistry) restConfigLocked(name string) (*rest.Config, error) {
+	if r.primaries[name] {
+		return r.primaryConfig, nil
+	}
+
+	c, ok := r.clusters[name]
+	if !ok {
+		return nil, fmt.Errorf("cluster %s not found in kubeconfig", name)
+	}
+
+	if c.config == nil {
+		config, err := clientcmd.NewNonInteractiveClientConfig(
+			*r.kubeconfig,
+			c.context,
+			&clientcmd.ConfigOverrides{},
+			nil,
+		).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client config for %s: %w", name, err)
+		}
+		config.Wrap(tracing.WrapTransport(name))
+		c.config = config
+	}
+
+	return c.config, nil
+}
+
+func (r *ClusterRegistry) clientsetLocked(name string) (kubernetes.Interface, error) {
+	if r.primaries[name] {
+		if r.primaryClientset == nil {
+			cs, err := newCachedClientset(r.primaryConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create clientset: %w", err)
+			}
+			r.primaryClientset = cs
+		}
+
+		return r.primaryClientset, nil
+	}
+
+	config, err := r.restConfigLocked(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c := r.clusters[name]
+	if c.clientset == nil {
+		cs, err := newCachedClientset(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create clientset for %s: %w", name, err)
+		}
+		c.clientset = cs
+	}
+
+	return c.clientset, nil
+}
+
+// Return the clientset of the primary cluster, keyed by the name of its ClusterDetector.
+func (r *ClusterRegistry) PrimaryClientsets(ctx context.Context) (map[string]kubernetes.Interface, error) {
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clientsets := make(map[string]kubernetes.Interface)
+	for name := range r.primaries {
+		cs, err := r.clientsetLocked(name)
+		if err != nil {
+			return nil, err
+		}
+		clientsets[name] = cs
+	}
+
+	return clientsets, nil
+}
+
+// Return the clientsets for the secondary clusters listed in .spec.targetCluster.
+// If the clientset for some clusters cannot be created, the clientsets that could be
+// created are returned together with the error, so that callers such as the finalizer
+// can still work on the reachable clusters.
+// The primary cluster, i.e. the cluster whose ClusterDetector has .spec.primary, is never a secondary cluster.
+func (r *ClusterRegistry) SecondaryClientsets(
+	ctx context.Context,
+	replicator plumberv1.Replicator,
+) (map[string]kubernetes.Interface, error) {
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var createErr error
+	clientsets := make(map[string]kubernetes.Interface)
+	for _, secondaryCluster := range replicator.Spec.TargetCluster {
+		if r.primaries[secondaryCluster] {
+			createErr = multierr.Append(createErr,
+				fmt.Errorf("cluster %s is the primary cluster, it cannot be a target cluster", secondaryCluster))
+			continue
+		}
+		cs, err := r.clientsetLocked(secondaryCluster)
+		if err != nil {
+			createErr = multierr.Append(createErr, err)
+			continue
+		}
+		clientsets[secondaryCluster] = cs
+	}
+
+	return clientsets, createErr
+}
+
+// Return the names of the clusters whose ClusterDetector has .spec.primary.
+// Before the ClusterDetector of the primary cluster has been created, the primary name is returned.
+func (r *ClusterRegistry) primaryClusters(ctx context.Context) (map[string]bool, error) {
+	var clusterDetectors plumberv1.ClusterDetectorList
+	if err := r.client.List(ctx, &clusterDetectors, client.InNamespace(constants.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list ClusterDetectors: %w", err)
+	}
+
+	primaries := make(map[string]bool)
+	for _, clusterDetector := range clusterDetectors.Items {
+		if clusterDetector.Spec.Primary {
+			primaries[clusterDetector.GetName()] = true
+		}
+	}
+	if len(primaries) == 0 {
+		primaries[r.primaryName] = true
+	}
+
+	return primaries, nil
+}
+
+// A clientset whose discovery results are cached in memory.
+type cachedClientset struct {
+	kubernetes.Interface
+	discovery discovery.CachedDiscoveryInterface
+}
+
+func newCachedClientset(config *rest.Config) (*cachedClientset, error) {
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cachedClientset{
+		Interface: cs,
+		discovery: memory.NewMemCacheClient(cs.Discovery()),
+	}, nil
+}
+
+func (c *cachedClientset) Discovery() discovery.DiscoveryInterface {
+	return c.discovery
+}
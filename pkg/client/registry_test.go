@@ -0,0 +1,343 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+	"github.com/jnytnai0613/plumber/pkg/constants"
+)
+
+const testPrimaryCluster = "primary-cluster.primary-admin"
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := plumberv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	return scheme
+}
+
+// Return a kubeconfig Secret with a context for each server, named "<name>.<name>-admin" as a cluster.
+func newTestKubeconfigSecret(t *testing.T, servers map[string]string) *corev1.Secret {
+	config := clientcmdapi.NewConfig()
+	for name, server := range servers {
+		config.Clusters[name] = &clientcmdapi.Cluster{Server: server}
+		config.AuthInfos[name+"-admin"] = &clientcmdapi.AuthInfo{Token: name}
+		config.Contexts[name] = &clientcmdapi.Context{Cluster: name, AuthInfo: name + "-admin"}
+	}
+	data, err := clientcmd.Write(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      constants.KubeconfigSecretName,
+			Namespace: constants.KubeconfigSecretNamespace,
+		},
+		Data: map[string][]byte{constants.KubeconfigSecretKey: data},
+	}
+}
+
+func TestSecondaryClientsetsExcludePrimary(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		secret = newTestKubeconfigSecret(t, map[string]string{
+			"primary-cluster": "https://primary",
+			"secondary":       "https://secondary",
+		})
+		cli = fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(secret).Build()
+	)
+
+	// Before the ClusterDetector of the primary cluster is created, the primary cluster is registered under the primary name.
+	registry := NewClusterRegistry(cli, &rest.Config{Host: "https://primary"}, testPrimaryCluster)
+	if name := registry.PrimaryClusterName(); name != testPrimaryCluster {
+		t.Errorf("expected the primary cluster %s, got %s", testPrimaryCluster, name)
+	}
+
+	replicator := plumberv1.Replicator{Spec: plumberv1.ReplicatorSpec{
+		TargetCluster: []string{"secondary.secondary-admin", testPrimaryCluster},
+	}}
+	clientsets, err := registry.SecondaryClientsets(ctx, replicator)
+	if err == nil || !strings.Contains(err.Error(), testPrimaryCluster+" is the primary cluster") {
+		t.Errorf("expected the primary cluster to be rejected, got %v", err)
+	}
+	if _, ok := clientsets["secondary.secondary-admin"]; !ok || len(clientsets) != 1 {
+		t.Errorf("expected only the secondary cluster, got %v", clientsets)
+	}
+
+	primaries, err := registry.PrimaryClientsets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := primaries[testPrimaryCluster]; !ok || len(primaries) != 1 {
+		t.Errorf("expected the configured primary cluster, got %v", primaries)
+	}
+}
+
+func TestPrimaryClusterDetector(t *testing.T) {
+	const (
+		primaryCluster = "kubernetes.kubernetes-admin"
+		// The names of --primary-cluster and --primary-user.
+		configured = "primary-cluster.primary-cluster-admin"
+		secondary  = "secondary.secondary-admin"
+	)
+
+	var (
+		ctx    = context.Background()
+		secret = newTestKubeconfigSecret(t, map[string]string{
+			"kubernetes":      "https://kubernetes",
+			"primary-cluster": "https://primary-cluster",
+			"secondary":       "https://secondary",
+		})
+		// The ClusterDetector of the primary cluster was created with other names than --primary-cluster.
+		clusterDetectors = []client.Object{
+			&plumberv1.ClusterDetector{
+				ObjectMeta: metav1.ObjectMeta{Name: primaryCluster, Namespace: constants.Namespace},
+				Spec:       plumberv1.ClusterDetectorSpec{Primary: true},
+			},
+			&plumberv1.ClusterDetector{
+				ObjectMeta: metav1.ObjectMeta{Name: configured, Namespace: constants.Namespace},
+			},
+		}
+		cli = fake.NewClientBuilder().
+			WithScheme(newTestScheme(t)).
+			WithObjects(append(clusterDetectors, secret)...).
+			Build()
+	)
+
+	registry := NewClusterRegistry(cli, &rest.Config{Host: "https://primary"}, configured)
+
+	primaries, err := registry.PrimaryClientsets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := primaries[primaryCluster]; !ok || len(primaries) != 1 {
+		t.Fatalf("expected the cluster of the primary ClusterDetector, got %v", primaries)
+	}
+
+	// The kubeconfig entry of the primary cluster is not registered, the primary cluster is accessed with the primary config.
+	config, err := registry.RESTConfig(ctx, primaryCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Host != "https://primary" {
+		t.Errorf("expected the primary config, got %s", config.Host)
+	}
+	cs, err := registry.Clientset(ctx, primaryCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs != primaries[primaryCluster] {
+		t.Errorf("expected the clientset of the primary cluster")
+	}
+
+	// The primary name of the registry does not make a cluster primary.
+	replicator := plumberv1.Replicator{Spec: plumberv1.ReplicatorSpec{
+		TargetCluster: []string{secondary, configured, primaryCluster},
+	}}
+	clientsets, err := registry.SecondaryClientsets(ctx, replicator)
+	if err == nil || !strings.Contains(err.Error(), primaryCluster+" is the primary cluster") {
+		t.Errorf("expected the primary cluster to be rejected, got %v", err)
+	}
+	if _, ok := clientsets[primaryCluster]; ok {
+		t.Errorf("expected the primary cluster not to be a secondary cluster")
+	}
+	for _, name := range []string{secondary, configured} {
+		if _, ok := clientsets[name]; !ok {
+			t.Errorf("expected the secondary cluster %s, got %v", name, clientsets)
+		}
+	}
+	config, err = registry.RESTConfig(ctx, configured)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Host != "https://primary-cluster" {
+		t.Errorf("expected the kubeconfig entry of %s, got %s", configured, config.Host)
+	}
+}
+
+func TestClientsetCache(t *testing.T) {
+	const (
+		clusterA = "a.a-admin"
+		clusterB = "b.b-admin"
+	)
+
+	tests := []struct {
+		name string
+		// Change the kubeconfig Secret or the registry between two calls to Clientset.
+		change  func(t *testing.T, cli client.Client, registry *ClusterRegistry)
+		rebuilt map[string]bool
+	}{
+		{
+			name:    "unchanged resourceVersion",
+			change:  func(*testing.T, client.Client, *ClusterRegistry) {},
+			rebuilt: map[string]bool{},
+		},
+		{
+			name: "changed resourceVersion",
+			change: func(t *testing.T, cli client.Client, _ *ClusterRegistry) {
+				secret := newTestKubeconfigSecret(t, map[string]string{
+					"a": "https://a.example.com",
+					"b": "https://b",
+				})
+				if err := cli.Update(context.Background(), secret); err != nil {
+					t.Fatal(err)
+				}
+			},
+			rebuilt: map[string]bool{clusterA: true},
+		},
+		{
+			name: "invalidated cluster",
+			change: func(_ *testing.T, _ client.Client, registry *ClusterRegistry) {
+				registry.Invalidate(clusterB)
+			},
+			rebuilt: map[string]bool{clusterB: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				ctx = context.Background()
+				cli = fake.NewClientBuilder().
+					WithScheme(newTestScheme(t)).
+					WithObjects(newTestKubeconfigSecret(t, map[string]string{
+						"a": "https://a",
+						"b": "https://b",
+					})).
+					Build()
+				registry = NewClusterRegistry(cli, &rest.Config{Host: "https://primary"}, testPrimaryCluster)
+			)
+
+			before := make(map[string]kubernetes.Interface)
+			for _, name := range []string{clusterA, clusterB} {
+				cs, err := registry.Clientset(ctx, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				before[name] = cs
+			}
+
+			tt.change(t, cli, registry)
+
+			for _, name := range []string{clusterA, clusterB} {
+				cs, err := registry.Clientset(ctx, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rebuilt := cs != before[name]; rebuilt != tt.rebuilt[name] {
+					t.Errorf("expected the clientset of %s to be rebuilt: %t, got %t", name, tt.rebuilt[name], rebuilt)
+				}
+			}
+
+			if tt.rebuilt[clusterA] {
+				config, err := registry.RESTConfig(ctx, clusterA)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if config.Host != "https://a.example.com" {
+					t.Errorf("expected the rebuilt clientset to use the new server, got %s", config.Host)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidateDiscovery(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api":
+			fmt.Fprint(w, `{"kind":"APIVersions","versions":["v1"]}`)
+		case "/apis":
+			fmt.Fprint(w, `{"kind":"APIGroupList","groups":[]}`)
+		case "/api/v1":
+			mu.Lock()
+			requests++
+			mu.Unlock()
+			fmt.Fprint(w, `{"kind":"APIResourceList","groupVersion":"v1","resources":[{"name":"pods","namespaced":true,"kind":"Pod","verbs":["get"]}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var (
+		ctx = context.Background()
+		cli = fake.NewClientBuilder().
+			WithScheme(newTestScheme(t)).
+			WithObjects(newTestKubeconfigSecret(t, map[string]string{"a": server.URL})).
+			Build()
+		registry = NewClusterRegistry(cli, &rest.Config{Host: "https://primary"}, testPrimaryCluster)
+	)
+	discover := func() kubernetes.Interface {
+		cs, err := registry.Clientset(ctx, "a.a-admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cs.Discovery().ServerResourcesForGroupVersion("v1"); err != nil {
+			t.Fatal(err)
+		}
+		return cs
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+
+	before := discover()
+	discover()
+	if n := count(); n != 1 {
+		t.Fatalf("expected the discovery results to be cached, got %d requests", n)
+	}
+
+	registry.InvalidateDiscovery("a.a-admin")
+	if after := discover(); after != before {
+		t.Error("expected the clientset to be kept")
+	}
+	if n := count(); n != 2 {
+		t.Errorf("expected the APIs to be discovered again, got %d requests", n)
+	}
+}
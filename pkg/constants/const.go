@@ -37,6 +37,24 @@ const (
 	ClientSecretName  = "cli-secret"
 )
 
+// Replicator Info
+const (
+	FinalizerName = "plumber.jnytnai0613.github.io/finalizer"
+
+	// When set to "true" on a Replicator being deleted, the cleanup of the
+	// secondary clusters is skipped and the finalizer is removed immediately.
+	ForceDeleteAnnotation = "plumber.jnytnai0613.github.io/force-delete"
+
+	// Changing the value triggers an immediate sync, even while the Replicator is suspended.
+	SyncNowAnnotation = "plumber.jnytnai0613.github.io/sync-now"
+)
+
+// Label Info
+const (
+	// Set on every replicated resource with the name of the owning Replicator.
+	ReplicatorLabel = "plumber.jnytnai0613.github.io/replicator"
+)
+
 // Ingress Info
 const (
 	IngressClassName = "nginx"
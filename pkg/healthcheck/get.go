@@ -16,38 +16,158 @@ limitations under the License.
 package healthcheck
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
-	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/rest"
 )
 
-// Throw a request to kube-apiserver on the remote Kubernetes cluster
-// and check if it can communicate successfully.
-// The following function throws a request to the "livez" API endpoint.
+type State string
+
+const (
+	// The kube-apiserver reports itself as live and ready.
+	StateHealthy State = "Healthy"
+	// No response was received from the kube-apiserver.
+	StateUnreachable State = "Unreachable"
+	// The certificate of the kube-apiserver could not be verified against the CA of the cluster,
+	// or the client certificate was rejected.
+	StateTLSError State = "TLSError"
+	// The kube-apiserver rejected the credentials.
+	StateUnauthorized State = "Unauthorized"
+	// The kube-apiserver responded, but is not live or not ready.
+	StateUnhealthy State = "Unhealthy"
+)
+
+// If no response is received within this time, the health check fails.
+const timeout = 2 * time.Second
+
+// Health check endpoints of the kube-apiserver, checked in order.
 // https://kubernetes.io/docs/reference/using-api/health-checks/
-func HealthChecks(target clientcmdapi.Cluster) error {
-	client := http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				// Since no communication is made using certificates,　certificate
-				// verification is skipped.
-				InsecureSkipVerify: true,
-			},
-		},
-		// If no response is received within 2 seconds,
-		// the communication is considered to have failed.
-		Timeout: 2 * time.Second,
-	}
-
-	u := fmt.Sprintf("%s%s", target.Server, "/livez")
-	resp, err := client.Get(u)
+var endpoints = []string{"/livez", "/readyz"}
+
+// Error is returned by HealthChecks when the cluster is not healthy.
+type Error struct {
+	State State
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.State, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Return the state of the cluster reported by the error of HealthChecks.
+func StateOf(err error) State {
+	if err == nil {
+		return StateHealthy
+	}
+
+	var healthErr *Error
+	if errors.As(err, &healthErr) {
+		return healthErr.State
+	}
+
+	return StateUnreachable
+}
+
+// Throw requests to the kube-apiserver on the remote Kubernetes cluster
+// and check if it is live and ready.
+// The certificate of the kube-apiserver is verified against the CA of the cluster,
+// and the requests are authenticated with the credentials in config.
+// If a check fails, the names of the failing checks are included in the error.
+func HealthChecks(ctx context.Context, config *rest.Config) error {
+	config = rest.CopyConfig(config)
+	config.Timeout = timeout
+
+	client, err := rest.HTTPClientFor(config)
 	if err != nil {
-		return fmt.Errorf("failed to get response from %s: %w", u, err)
+		return &Error{State: StateTLSError, Err: fmt.Errorf("failed to create client: %w", err)}
+	}
+
+	for _, endpoint := range endpoints {
+		if err := check(ctx, client, config.Host, endpoint); err != nil {
+			return err
+		}
 	}
-	defer resp.Body.Close()
 
 	return nil
 }
+
+func check(ctx context.Context, client *http.Client, host, endpoint string) error {
+	u := fmt.Sprintf("%s%s?verbose", strings.TrimSuffix(host, "/"), endpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return &Error{State: StateUnreachable, Err: err}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if isTLSError(err) {
+			return &Error{State: StateTLSError, Err: fmt.Errorf("failed to get response from %s: %w", u, err)}
+		}
+		return &Error{State: StateUnreachable, Err: fmt.Errorf("failed to get response from %s: %w", u, err)}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return &Error{State: StateUnreachable, Err: fmt.Errorf("failed to read response from %s: %w", u, err)}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &Error{State: StateUnauthorized, Err: fmt.Errorf("%s returned %s", endpoint, resp.Status)}
+	}
+
+	return &Error{
+		State: StateUnhealthy,
+		Err:   fmt.Errorf("%s returned %s: %s", endpoint, resp.Status, failedChecks(body)),
+	}
+}
+
+// Extract the failing checks from a verbose health check response,
+// e.g. "[-]etcd failed: reason withheld".
+func failedChecks(body []byte) string {
+	var failed []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.HasPrefix(line, "[-]") {
+			failed = append(failed, strings.TrimPrefix(line, "[-]"))
+		}
+	}
+	if len(failed) == 0 {
+		return strings.TrimSpace(string(body))
+	}
+
+	return strings.Join(failed, ", ")
+}
+
+func isTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+	switch {
+	case errors.As(err, &unknownAuthority),
+		errors.As(err, &hostname),
+		errors.As(err, &invalid),
+		errors.As(err, &recordHeader):
+		return true
+	}
+
+	// Alerts sent by the server, e.g. when the client certificate is rejected.
+	return strings.Contains(err.Error(), "tls: ")
+}
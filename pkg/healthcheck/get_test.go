@@ -0,0 +1,79 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package healthcheck
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestHealthChecks(t *testing.T) {
+	const token = "secret"
+
+	var readyz int
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/readyz" && readyz != 0 {
+			w.WriteHeader(readyz)
+			_, _ = w.Write([]byte("[+]ping ok\n[-]etcd failed: reason withheld\nreadyz check failed\n"))
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	config := func(ca []byte, bearer string) *rest.Config {
+		return &rest.Config{
+			Host:            server.URL,
+			BearerToken:     bearer,
+			TLSClientConfig: rest.TLSClientConfig{CAData: ca},
+		}
+	}
+
+	ctx := context.Background()
+	if err := HealthChecks(ctx, config(caData, token)); err != nil {
+		t.Fatalf("expected the cluster to be healthy, got %v", err)
+	}
+
+	if err := HealthChecks(ctx, config(nil, token)); StateOf(err) != StateTLSError {
+		t.Errorf("expected a TLS error without the CA, got %v", err)
+	}
+
+	if err := HealthChecks(ctx, config(caData, "wrong")); StateOf(err) != StateUnauthorized {
+		t.Errorf("expected the credentials to be rejected, got %v", err)
+	}
+
+	readyz = http.StatusInternalServerError
+	err := HealthChecks(ctx, config(caData, token))
+	if StateOf(err) != StateUnhealthy || !strings.Contains(err.Error(), "etcd failed") {
+		t.Errorf("expected the cluster to be unhealthy because of etcd, got %v", err)
+	}
+
+	server.Close()
+	if err := HealthChecks(ctx, config(caData, token)); StateOf(err) != StateUnreachable {
+		t.Errorf("expected the cluster to be unreachable, got %v", err)
+	}
+}
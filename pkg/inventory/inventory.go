@@ -0,0 +1,140 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/multierr"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	plumberv1 "github.com/jnytnai0613/plumber/api/v1"
+)
+
+// If the inventory is not collected within this time, the collection fails.
+const timeout = 5 * time.Second
+
+// Collect the inventory of the cluster of the given config.
+func Collect(ctx context.Context, config *rest.Config) (*plumberv1.ClusterInventory, error) {
+	config = rest.CopyConfig(config)
+	config.Timeout = timeout
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
+	apiextensionsClientset, err := apiextensionsclientset.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create apiextensions clientset: %w", err)
+	}
+
+	return collect(ctx, clientset, apiextensionsClientset)
+}
+
+// Collect the inventory with the given clientsets.
+// Parts that could not be collected are left empty and their errors are returned with the inventory.
+func collect(
+	ctx context.Context,
+	clientset kubernetes.Interface,
+	apiextensionsClientset apiextensionsclientset.Interface,
+) (*plumberv1.ClusterInventory, error) {
+	var (
+		errs      error
+		now       = metav1.Now()
+		inventory = &plumberv1.ClusterInventory{LastUpdateTime: &now}
+	)
+
+	version, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("failed to get server version: %w", err))
+	} else {
+		inventory.KubernetesVersion = version.GitVersion
+		inventory.Platform = version.Platform
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("failed to list Nodes: %w", err))
+	} else {
+		inventory.Nodes = int32(len(nodes.Items))
+		inventory.Capacity = corev1.ResourceList{}
+		inventory.Allocatable = corev1.ResourceList{}
+		for _, node := range nodes.Items {
+			addResources(inventory.Capacity, node.Status.Capacity)
+			addResources(inventory.Allocatable, node.Status.Allocatable)
+		}
+	}
+
+	ingressClasses, err := clientset.NetworkingV1().IngressClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("failed to list IngressClasses: %w", err))
+	} else {
+		for _, ingressClass := range ingressClasses.Items {
+			inventory.IngressClasses = append(inventory.IngressClasses, ingressClass.GetName())
+		}
+		sort.Strings(inventory.IngressClasses)
+	}
+
+	storageClasses, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("failed to list StorageClasses: %w", err))
+	} else {
+		for _, storageClass := range storageClasses.Items {
+			inventory.StorageClasses = append(inventory.StorageClasses, storageClass.GetName())
+		}
+		sort.Strings(inventory.StorageClasses)
+	}
+
+	crds, err := apiextensionsClientset.ApiextensionsV1().CustomResourceDefinitions().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("failed to list CustomResourceDefinitions: %w", err))
+	} else {
+		groups := make(map[string]bool)
+		for _, crd := range crds.Items {
+			if !groups[crd.Spec.Group] {
+				groups[crd.Spec.Group] = true
+				inventory.CRDGroups = append(inventory.CRDGroups, crd.Spec.Group)
+			}
+		}
+		sort.Strings(inventory.CRDGroups)
+	}
+
+	return inventory, errs
+}
+
+// Add the cpu and memory of a node to the total.
+func addResources(total, resources corev1.ResourceList) {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		quantity, ok := resources[name]
+		if !ok {
+			continue
+		}
+		sum, ok := total[name]
+		if !ok {
+			sum = resource.Quantity{Format: quantity.Format}
+		}
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inventory
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newNode(name, cpu, memory string) *corev1.Node {
+	resources := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+		corev1.ResourcePods:   resource.MustParse("110"),
+	}
+
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     corev1.NodeStatus{Capacity: resources, Allocatable: resources},
+	}
+}
+
+func newCRD(name, group string) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       apiextensionsv1.CustomResourceDefinitionSpec{Group: group},
+	}
+}
+
+func TestCollect(t *testing.T) {
+	clientset := k8sfake.NewSimpleClientset(
+		newNode("node1", "2", "4Gi"),
+		newNode("node2", "1500m", "2Gi"),
+		&networkingv1.IngressClass{ObjectMeta: metav1.ObjectMeta{Name: "nginx"}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "standard"}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}},
+	)
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{
+		GitVersion: "v1.27.2",
+		Platform:   "linux/amd64",
+	}
+	apiextensionsClientset := apiextensionsfake.NewSimpleClientset(
+		newCRD("replicators.plumber.jnytnai0613.github.io", "plumber.jnytnai0613.github.io"),
+		newCRD("clusterdetectors.plumber.jnytnai0613.github.io", "plumber.jnytnai0613.github.io"),
+		newCRD("certificates.cert-manager.io", "cert-manager.io"),
+	)
+
+	inventory, err := collect(context.Background(), clientset, apiextensionsClientset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inventory.KubernetesVersion != "v1.27.2" || inventory.Platform != "linux/amd64" || inventory.Nodes != 2 {
+		t.Errorf("unexpected inventory: %+v", inventory)
+	}
+	if cpu := inventory.Capacity[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse("3500m")) != 0 {
+		t.Errorf("expected 3500m cpu, got %s", cpu.String())
+	}
+	if memory := inventory.Allocatable[corev1.ResourceMemory]; memory.Cmp(resource.MustParse("6Gi")) != 0 {
+		t.Errorf("expected 6Gi memory, got %s", memory.String())
+	}
+	if _, ok := inventory.Capacity[corev1.ResourcePods]; ok {
+		t.Errorf("expected only cpu and memory, got %v", inventory.Capacity)
+	}
+	if !reflect.DeepEqual(inventory.IngressClasses, []string{"nginx"}) {
+		t.Errorf("unexpected IngressClasses: %v", inventory.IngressClasses)
+	}
+	if !reflect.DeepEqual(inventory.StorageClasses, []string{"fast", "standard"}) {
+		t.Errorf("unexpected StorageClasses: %v", inventory.StorageClasses)
+	}
+	if !reflect.DeepEqual(inventory.CRDGroups, []string{"cert-manager.io", "plumber.jnytnai0613.github.io"}) {
+		t.Errorf("unexpected CRD groups: %v", inventory.CRDGroups)
+	}
+}
+
+func TestCollectPartial(t *testing.T) {
+	clientset := k8sfake.NewSimpleClientset(newNode("node1", "2", "4Gi"))
+	clientset.PrependReactor("list", "storageclasses", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+
+	inventory, err := collect(context.Background(), clientset, apiextensionsfake.NewSimpleClientset())
+	if err == nil {
+		t.Fatal("expected the error of the StorageClasses")
+	}
+	if inventory.Nodes != 1 || inventory.StorageClasses != nil {
+		t.Errorf("expected the rest of the inventory to be collected, got %+v", inventory)
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 
 	"github.com/spf13/viper"
 
@@ -136,8 +138,41 @@ func GenerateConfigFile(path string, cluster string) error {
 	return nil
 }
 
+// Return the name under which the cluster of the context is registered, i.e. the name of its ClusterDetector.
+// .Metadata.Name must be a lowercase RFC 1123 subdomain, which a context name may not be,
+// so the format is "ClusterName.UserName".
+func ClusterIdentity(context *clientcmdapi.Context) string {
+	return fmt.Sprintf("%s.%s", context.Cluster, context.AuthInfo)
+}
+
+// Return the cluster identities that are shared by more than one context, with the names of those contexts.
+func DuplicateClusterIdentities(config *clientcmdapi.Config) map[string][]string {
+	contexts := make(map[string][]string)
+	for name, context := range config.Contexts {
+		identity := ClusterIdentity(context)
+		contexts[identity] = append(contexts[identity], name)
+	}
+
+	duplicates := make(map[string][]string)
+	for identity, names := range contexts {
+		if len(names) > 1 {
+			sort.Strings(names)
+			duplicates[identity] = names
+		}
+	}
+
+	return duplicates
+}
+
 // Generate a kubeconfig file for the primary cluster.
-func GeneratePrimaryConfig(clientset *kubernetes.Clientset, restConfig *rest.Config) ([]byte, error) {
+// The cluster and user entries of the primary cluster are named cluster and authInfo.
+// If the kubeconfig Secret already exists, its primary context must use these names.
+func GeneratePrimaryConfig(
+	clientset *kubernetes.Clientset,
+	restConfig *rest.Config,
+	cluster string,
+	authInfo string,
+) ([]byte, error) {
 	secretClient := clientset.CoreV1().Secrets(constants.KubeconfigSecretNamespace)
 	secret, err := secretClient.Get(
 		context.TODO(),
@@ -150,17 +185,32 @@ func GeneratePrimaryConfig(clientset *kubernetes.Clientset, restConfig *rest.Con
 		}
 	}
 
+	cmdContext := &clientcmdapi.Context{
+		Cluster:  cluster,
+		AuthInfo: authInfo,
+	}
+
 	// If the secret resource exists, return the kubeconfig file.
 	if secret.Data[constants.KubeconfigSecretKey] != nil {
 		fmt.Println("The secret resource already exists.")
 		fmt.Println(string(secret.Data[constants.KubeconfigSecretKey]))
+
+		existing, err := clientcmd.Load(secret.Data[constants.KubeconfigSecretKey])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+		}
+		if primary, ok := existing.Contexts[constants.PrimaryContext]; ok &&
+			ClusterIdentity(primary) != ClusterIdentity(cmdContext) {
+			return nil, fmt.Errorf(
+				"the primary context of the kubeconfig secret is %s, not %s",
+				ClusterIdentity(primary),
+				ClusterIdentity(cmdContext),
+			)
+		}
+
 		return secret.Data[constants.KubeconfigSecretKey], nil
 	}
 
-	cmdContext := &clientcmdapi.Context{
-		Cluster:  constants.ClusterName,
-		AuthInfo: constants.AuthInfo,
-	}
 	cmdCluser := &clientcmdapi.Cluster{
 		Server:                   restConfig.Host,
 		CertificateAuthorityData: restConfig.CAData,
@@ -296,7 +346,21 @@ func ReadKubeconfigFromClient(cli client.Client) (*clientcmdapi.Config, error) {
 }
 
 // Merge the kubeconfig.
+// A cluster or user of the source that is already registered under the same name with different settings,
+// e.g. because both clusters were created by kubeadm, is rejected,
+// since the two clusters would share the same identity.
 func MargeKubeconfig(source clientcmdapi.Config, target clientcmdapi.Config) ([]byte, error) {
+	for k, v := range source.Clusters {
+		if curr, ok := target.Clusters[k]; ok && !reflect.DeepEqual(curr, v) {
+			return nil, fmt.Errorf("cluster %s is already registered with a different server, rename it in the kubeconfig", k)
+		}
+	}
+	for k, v := range source.AuthInfos {
+		if curr, ok := target.AuthInfos[k]; ok && !reflect.DeepEqual(curr, v) {
+			return nil, fmt.Errorf("user %s is already registered with different credentials, rename it in the kubeconfig", k)
+		}
+	}
+
 	// Merge the kubeconfig files.
 	for k, v := range target.Clusters {
 		source.Clusters[k] = v
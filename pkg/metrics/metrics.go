@@ -0,0 +1,122 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// Number of apply requests sent to each cluster per kind of resource.
+	ApplyTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "plumber_apply_total",
+			Help: "Number of apply requests per cluster and kind.",
+		},
+		[]string{"cluster", "kind"},
+	)
+
+	// Number of apply requests that failed.
+	ApplyFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "plumber_apply_failures_total",
+			Help: "Number of failed apply requests per cluster and kind.",
+		},
+		[]string{"cluster", "kind"},
+	)
+
+	// Latency of the apply requests.
+	ApplyDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "plumber_apply_duration_seconds",
+			Help:    "Latency of apply requests per cluster and kind.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"cluster", "kind"},
+	)
+
+	// Time from a change of the Replicator spec until it has been synced to all clusters.
+	ReplicationLag = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "plumber_replication_lag_seconds",
+			Help:    "Time from a generation change of a Replicator until all clusters are synced.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		},
+	)
+
+	// 1 if the ClusterDetector reports the cluster as RUNNING, 0 otherwise.
+	ClusterHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "plumber_cluster_healthy",
+			Help: "Whether the cluster is reported as RUNNING by its ClusterDetector.",
+		},
+		[]string{"cluster"},
+	)
+
+	// Number of clusters per role, primary or secondary.
+	Clusters = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "plumber_clusters",
+			Help: "Number of clusters per role.",
+		},
+		[]string{"role"},
+	)
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		ApplyTotal,
+		ApplyFailuresTotal,
+		ApplyDuration,
+		ReplicationLag,
+		ClusterHealthy,
+		Clusters,
+	)
+}
+
+// Record an apply request to the cluster that took duration and returned err.
+func ObserveApply(cluster, kind string, duration time.Duration, err error) {
+	ApplyTotal.WithLabelValues(cluster, kind).Inc()
+	ApplyDuration.WithLabelValues(cluster, kind).Observe(duration.Seconds())
+	if err != nil {
+		ApplyFailuresTotal.WithLabelValues(cluster, kind).Inc()
+	}
+}
+
+// Record whether the cluster is healthy.
+func SetClusterHealthy(cluster string, healthy bool) {
+	var value float64
+	if healthy {
+		value = 1
+	}
+	ClusterHealthy.WithLabelValues(cluster).Set(value)
+}
+
+// Remove the metrics of a cluster that is no longer in the kubeconfig.
+func DeleteCluster(cluster string) {
+	ClusterHealthy.DeleteLabelValues(cluster)
+}
+
+// Replace the number of clusters per role.
+func SetClusters(roles map[string]int) {
+	Clusters.Reset()
+	for role, count := range roles {
+		Clusters.WithLabelValues(role).Set(float64(count))
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveApply(t *testing.T) {
+	const cluster = "secondary.kubernetes-admin2"
+
+	ObserveApply(cluster, "Deployment", time.Second, nil)
+	ObserveApply(cluster, "Deployment", time.Second, errors.New("conflict"))
+
+	if n := testutil.ToFloat64(ApplyTotal.WithLabelValues(cluster, "Deployment")); n != 2 {
+		t.Errorf("expected 2 apply requests, got %v", n)
+	}
+	if n := testutil.ToFloat64(ApplyFailuresTotal.WithLabelValues(cluster, "Deployment")); n != 1 {
+		t.Errorf("expected 1 failed apply request, got %v", n)
+	}
+	if n := testutil.CollectAndCount(ApplyDuration); n != 1 {
+		t.Errorf("expected 1 latency histogram, got %d", n)
+	}
+}
+
+func TestClusters(t *testing.T) {
+	SetClusterHealthy("secondary.kubernetes-admin2", true)
+	SetClusterHealthy("third.kubernetes-admin3", false)
+	if n := testutil.ToFloat64(ClusterHealthy.WithLabelValues("third.kubernetes-admin3")); n != 0 {
+		t.Errorf("expected the cluster to be unhealthy, got %v", n)
+	}
+
+	DeleteCluster("third.kubernetes-admin3")
+	if n := testutil.CollectAndCount(ClusterHealthy); n != 1 {
+		t.Errorf("expected the deleted cluster to be removed, got %d clusters", n)
+	}
+
+	SetClusters(map[string]int{"primary": 1, "secondary": 2})
+	SetClusters(map[string]int{"primary": 1, "secondary": 1})
+	if n := testutil.ToFloat64(Clusters.WithLabelValues("secondary")); n != 1 {
+		t.Errorf("expected 1 secondary cluster, got %v", n)
+	}
+}